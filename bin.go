@@ -0,0 +1,282 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBinWait limits how long a request to the bin API may wait.
+const maxBinWait = 5 * time.Minute
+
+// BinRequest is a request recorded by a RequestBin.
+type BinRequest struct {
+	// ID numbers the requests to a bin from 1, and is not reused when
+	// the bin is cleared.
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	EchoRequest
+}
+
+// RequestBin records the requests it serves in bins named by the last
+// element of the path, so it may be mounted under any prefix. Each bin keeps
+// only its latest requests, up to the size given to NewRequestBin. The
+// recorded requests may be inspected with the methods of RequestBin, or over
+// HTTP with APIHandler.
+type RequestBin struct {
+	mu   sync.Mutex
+	size int
+	bins map[string]*requestBin
+}
+
+// requestBin is a ring buffer of the requests to a single bin.
+type requestBin struct {
+	requests []BinRequest
+	start    int   // index of the oldest request
+	received int   // requests received since the bin was cleared
+	lastID   int64 // ID of the latest request
+
+	// changed is closed, and replaced, whenever the bin changes
+	changed chan struct{}
+}
+
+// NewRequestBin provides a RequestBin keeping up to size requests in each
+// bin. If size is not positive, 100 is used.
+func NewRequestBin(size int) *RequestBin {
+	if size <= 0 {
+		size = 100
+	}
+	return &RequestBin{size: size, bins: make(map[string]*requestBin)}
+}
+
+// bin returns the bin named id, creating it if needed. rb.mu must be held.
+func (rb *RequestBin) bin(id string) *requestBin {
+	b, ok := rb.bins[id]
+	if !ok {
+		b = &requestBin{changed: make(chan struct{})}
+		rb.bins[id] = b
+	}
+	return b
+}
+
+// list returns the requests in b, oldest first.
+func (b *requestBin) list() []BinRequest {
+	list := make([]BinRequest, 0, len(b.requests))
+	list = append(list, b.requests[b.start:]...)
+	return append(list, b.requests[:b.start]...)
+}
+
+func (b *requestBin) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// ServeHTTP records r in the bin named by the last element of its path,
+// then responds with 200 OK.
+func (rb *RequestBin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := lastPathElement(r)
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxEchoBody+1))
+	if err != nil {
+		badRequest(w, r)
+		return
+	}
+	if len(body) > maxEchoBody {
+		writeCode(w, r, http.StatusRequestEntityTooLarge)
+		return
+	}
+	req := BinRequest{Time: time.Now(), EchoRequest: *newEchoRequest(r, body)}
+
+	rb.mu.Lock()
+	b := rb.bin(id)
+	b.lastID++
+	req.ID = b.lastID
+	if len(b.requests) < rb.size {
+		b.requests = append(b.requests, req)
+	} else {
+		b.requests[b.start] = req
+		b.start = (b.start + 1) % len(b.requests)
+	}
+	b.received++
+	b.notify()
+	rb.mu.Unlock()
+
+	writeCode(w, r, http.StatusOK)
+}
+
+// Requests returns the requests kept in the bin named id, oldest first.
+func (rb *RequestBin) Requests(id string) []BinRequest {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if b, ok := rb.bins[id]; ok {
+		return b.list()
+	}
+	return []BinRequest{}
+}
+
+// Request returns the request numbered n in the bin named id, if it is
+// still kept.
+func (rb *RequestBin) Request(id string, n int64) (BinRequest, bool) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if b, ok := rb.bins[id]; ok {
+		for _, req := range b.requests {
+			if req.ID == n {
+				return req, true
+			}
+		}
+	}
+	return BinRequest{}, false
+}
+
+// Wait waits until the bin named id has received n requests since it was
+// last cleared, then returns the requests it keeps. If that takes longer
+// than timeout, it returns the requests it has and false.
+func (rb *RequestBin) Wait(id string, n int, timeout time.Duration) ([]BinRequest, bool) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	return rb.wait(id, n, t.C, nil)
+}
+
+func (rb *RequestBin) wait(id string, n int, timeout <-chan time.Time, done <-chan struct{}) ([]BinRequest, bool) {
+	for {
+		rb.mu.Lock()
+		b := rb.bin(id)
+		if b.received >= n {
+			list := b.list()
+			rb.mu.Unlock()
+			return list, true
+		}
+		changed := b.changed
+		rb.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return rb.Requests(id), false
+		case <-done:
+			return rb.Requests(id), false
+		}
+	}
+}
+
+// Clear discards the requests in the bin named id.
+func (rb *RequestBin) Clear(id string) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if b, ok := rb.bins[id]; ok {
+		b.requests, b.start, b.received = nil, 0, 0
+		b.notify()
+	}
+}
+
+// APIHandler provides an http.Handler for inspecting the recorded requests,
+// using http.StripPrefix as needed.
+//
+//	GET    /{bin}        list the requests in the bin as JSON, oldest first
+//	GET    /{bin}/{n}    get the request numbered n as JSON
+//	DELETE /{bin}        clear the bin
+//
+// A list request with a wait query parameter is held until the bin has
+// received that many requests since it was cleared, or until the duration
+// given by the timeout parameter, 30s by default, has passed. If the
+// timeout passes first, the requests in the bin are listed with 408 Request
+// Timeout.
+//
+//	GET /hook?wait=3&timeout=10s
+func (rb *RequestBin) APIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if parts[0] == "" || len(parts) > 2 {
+			http.NotFound(w, r)
+			return
+		}
+		id := parts[0]
+		if len(parts) == 2 {
+			rb.serveAPIRequest(w, r, id, parts[1])
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			rb.serveAPIList(w, r, id)
+		case http.MethodDelete:
+			rb.Clear(id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (rb *RequestBin) serveAPIList(w http.ResponseWriter, r *http.Request, id string) {
+	query := r.URL.Query()
+	if query.Get("wait") == "" {
+		serveBinJSON(w, r, http.StatusOK, rb.Requests(id))
+		return
+	}
+	n, err := strconv.Atoi(query.Get("wait"))
+	if err != nil || n < 0 {
+		http.Error(w, "handy: invalid wait "+strconv.Quote(query.Get("wait")), http.StatusBadRequest)
+		return
+	}
+	timeout := 30 * time.Second
+	if s := query.Get("timeout"); s != "" {
+		if timeout, err = time.ParseDuration(s); err != nil || timeout < 0 || timeout > maxBinWait {
+			http.Error(w, "handy: invalid timeout "+strconv.Quote(s), http.StatusBadRequest)
+			return
+		}
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	list, ok := rb.wait(id, n, t.C, r.Context().Done())
+	code := http.StatusOK
+	if !ok {
+		code = http.StatusRequestTimeout
+	}
+	serveBinJSON(w, r, code, list)
+}
+
+func (rb *RequestBin) serveAPIRequest(w http.ResponseWriter, r *http.Request, id, ns string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := strconv.ParseInt(ns, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	req, ok := rb.Request(id, n)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	serveBinJSON(w, r, http.StatusOK, req)
+}
+
+func serveBinJSON(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
@@ -0,0 +1,137 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestRequestBin(t *testing.T) {
+	rb := handy.NewRequestBin(3)
+	mux := http.NewServeMux()
+	mux.Handle("/hooks/", rb)
+	mux.Handle("/api/", http.StripPrefix("/api", rb.APIHandler()))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	get := func(path string, wantCode int, v interface{}) {
+		res, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error on GET %s: %+v", path, err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != wantCode {
+			t.Fatalf("GET %s status %d, expected %d", path, res.StatusCode, wantCode)
+		}
+		if v != nil {
+			if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+				t.Fatalf("unexpected error decoding GET %s: %+v", path, err)
+			}
+		}
+	}
+	post := func(bin, body string) {
+		res, err := http.Post(s.URL+"/hooks/"+bin, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error posting to %s: %+v", bin, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("posting to %s returned status %d, expected 200", bin, res.StatusCode)
+		}
+	}
+	ids := func(list []handy.BinRequest) string {
+		var s []string
+		for _, req := range list {
+			s = append(s, strconv.FormatInt(req.ID, 10)+":"+req.Body)
+		}
+		return strings.Join(s, ",")
+	}
+
+	var list []handy.BinRequest
+	get("/api/a", http.StatusOK, &list)
+	if len(list) != 0 {
+		t.Fatalf("new bin has requests %s", ids(list))
+	}
+
+	for i := 1; i <= 5; i++ {
+		post("a", strconv.Itoa(i))
+	}
+	post("b", "other")
+	get("/api/a", http.StatusOK, &list)
+	if got := ids(list); got != "3:3,4:4,5:5" {
+		t.Fatalf("bin has requests %s, expected the latest three", got)
+	}
+	if list[0].Method != "POST" || list[0].URL != "/hooks/a" || list[0].Time.IsZero() {
+		t.Fatalf("unexpected request %+v", list[0])
+	}
+
+	var req handy.BinRequest
+	get("/api/a/4", http.StatusOK, &req)
+	if req.ID != 4 || req.Body != "4" {
+		t.Fatalf("request %d with body %q, expected request 4", req.ID, req.Body)
+	}
+	get("/api/a/1", http.StatusNotFound, nil)
+	get("/api/a/x", http.StatusNotFound, nil)
+	get("/api/b/1", http.StatusOK, &req)
+
+	r, _ := http.NewRequest("DELETE", s.URL+"/api/a", nil)
+	if res, err := http.DefaultClient.Do(r); err != nil || res.StatusCode != http.StatusNoContent {
+		t.Fatalf("clearing bin returned %v, %v, expected 204", res, err)
+	}
+	get("/api/a", http.StatusOK, &list)
+	if len(list) != 0 {
+		t.Fatalf("cleared bin has requests %s", ids(list))
+	}
+	if got := ids(rb.Requests("b")); got != "1:other" {
+		t.Fatalf("other bin has requests %s after clear, expected it untouched", got)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		post("a", "6")
+		post("a", "7")
+	}()
+	get("/api/a?wait=2&timeout=5s", http.StatusOK, &list)
+	if got := ids(list); got != "6:6,7:7" {
+		t.Fatalf("waited for requests %s, expected 6 and 7", got)
+	}
+	get("/api/a?wait=3&timeout=10ms", http.StatusRequestTimeout, &list)
+	if got := ids(list); got != "6:6,7:7" {
+		t.Fatalf("timed out with requests %s, expected 6 and 7", got)
+	}
+	get("/api/a?wait=x", http.StatusBadRequest, nil)
+	get("/api/a?wait=1&timeout=1h", http.StatusBadRequest, nil)
+	get("/api/", http.StatusNotFound, nil)
+}
+
+func TestRequestBinWait(t *testing.T) {
+	rb := handy.NewRequestBin(0)
+	done := make(chan []handy.BinRequest)
+	go func() {
+		list, _ := rb.Wait("hook", 2, 5*time.Second)
+		done <- list
+	}()
+	for i := 0; i < 2; i++ {
+		rb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/hook", strings.NewReader("x")))
+	}
+	select {
+	case list := <-done:
+		if len(list) != 2 {
+			t.Fatalf("waited for %d requests, expected 2", len(list))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("wait did not return")
+	}
+	if _, ok := rb.Wait("hook", 3, 10*time.Millisecond); ok {
+		t.Fatalf("wait for a third request succeeded, expected timeout")
+	}
+}
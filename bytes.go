@@ -0,0 +1,133 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+// maxChunkSize limits the chunk_size of ServeStreamBytes.
+const maxChunkSize = 1 << 20
+
+// ServeBytes provides a handler that serves the number of pseudo-random bytes
+// indicated by the last element of the path, with a Content-Length, so it may
+// be mounted under any prefix. The bytes are the same for every request with
+// the same seed query parameter, an integer which is zero if not given.
+// Sizes that are negative or larger than maxSize are not found.
+func ServeBytes(maxSize int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, rnd, ok := randomPayload(w, r, maxSize)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		if r.Method != http.MethodHead {
+			io.CopyN(w, rnd, size)
+		}
+	})
+}
+
+// ServeStreamBytes provides a handler like ServeBytes, serving the same bytes
+// for the same seed, that streams them with chunked encoding, flushing after
+// each chunk of chunk_size bytes, 10240 if not given.
+//
+//	/stream-bytes/1000000?seed=42&chunk_size=1024
+func ServeStreamBytes(maxSize int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunkSize := 10240
+		if s := r.URL.Query().Get("chunk_size"); s != "" {
+			var err error
+			if chunkSize, err = strconv.Atoi(s); err != nil || chunkSize <= 0 || chunkSize > maxChunkSize {
+				badRequest(w, r)
+				return
+			}
+		}
+		size, rnd, ok := randomPayload(w, r, maxSize)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if r.Method == http.MethodHead {
+			return
+		}
+		chunk := make([]byte, chunkSize)
+		for size > 0 {
+			n := int64(len(chunk))
+			if n > size {
+				n = size
+			}
+			rnd.Read(chunk[:n])
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return
+			}
+			flush(w)
+			size -= n
+		}
+	})
+}
+
+// StreamLine is a line served by ServeStream.
+type StreamLine struct {
+	ID   int    `json:"id"`
+	Data string `json:"data"`
+}
+
+// ServeStream provides a handler that streams the number of JSON lines
+// indicated by the last element of the path, flushing after each, so it may
+// be mounted under any prefix. Each line is a StreamLine numbered from 0,
+// with pseudo-random data that is the same for every request with the same
+// seed query parameter. Counts that are negative or larger than maxLines are
+// not found.
+func ServeStream(maxLines int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lines, rnd, ok := randomPayload(w, r, int64(maxLines))
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if r.Method == http.MethodHead {
+			return
+		}
+		enc := json.NewEncoder(w)
+		data := make([]byte, 16)
+		for i := 0; i < int(lines); i++ {
+			rnd.Read(data)
+			if err := enc.Encode(StreamLine{ID: i, Data: hex.EncodeToString(data)}); err != nil {
+				return
+			}
+			flush(w)
+		}
+	})
+}
+
+// randomPayload parses the size given by the last element of the path and
+// the seed query parameter, responding to the request if either is invalid.
+func randomPayload(w http.ResponseWriter, r *http.Request, maxSize int64) (int64, *rand.Rand, bool) {
+	size, err := strconv.ParseInt(lastPathElement(r), 10, 64)
+	if err != nil || size < 0 || size > maxSize {
+		http.NotFound(w, r)
+		return 0, nil, false
+	}
+	var seed int64
+	if s := r.URL.Query().Get("seed"); s != "" {
+		if seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+			badRequest(w, r)
+			return 0, nil, false
+		}
+	}
+	return size, rand.New(rand.NewSource(seed)), true
+}
+
+// flush sends any buffered response to the client, if w supports it.
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
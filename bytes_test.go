@@ -0,0 +1,133 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestServeBytes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/bytes/", handy.ServeBytes(1<<20))
+	mux.Handle("/stream-bytes/", handy.ServeStreamBytes(1<<20))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	get := func(path string) (*http.Response, []byte) {
+		res, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error on GET %s: %+v", path, err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("unexpected error reading GET %s: %+v", path, err)
+		}
+		return res, body
+	}
+
+	res, seeded := get("/bytes/100000?seed=42")
+	if res.StatusCode != http.StatusOK || res.ContentLength != 100000 || len(seeded) != 100000 {
+		t.Fatalf("served status %d, length %d, %d bytes, expected 100000 bytes", res.StatusCode, res.ContentLength, len(seeded))
+	}
+	if _, again := get("/bytes/100000?seed=42"); !bytes.Equal(again, seeded) {
+		t.Fatalf("bytes differ for the same seed")
+	}
+	if _, other := get("/bytes/100000?seed=43"); bytes.Equal(other, seeded) {
+		t.Fatalf("bytes are the same for different seeds")
+	}
+	if _, unseeded := get("/bytes/100"); bytes.Equal(unseeded, seeded[:100]) {
+		t.Fatalf("bytes without a seed are the same as for seed 42")
+	}
+
+	for _, path := range []string{"/stream-bytes/100000?seed=42", "/stream-bytes/100000?seed=42&chunk_size=999"} {
+		res, streamed := get(path)
+		if res.StatusCode != http.StatusOK || res.ContentLength != -1 || len(res.TransferEncoding) != 1 || res.TransferEncoding[0] != "chunked" {
+			t.Fatalf("%s served status %d, length %d, encoding %v, expected chunked", path, res.StatusCode, res.ContentLength, res.TransferEncoding)
+		}
+		if !bytes.Equal(streamed, seeded) {
+			t.Fatalf("%s streamed different bytes than served by /bytes", path)
+		}
+	}
+
+	testCases := []struct {
+		path     string
+		wantCode int
+	}{
+		{"/bytes/0", http.StatusOK},
+		{"/bytes/1048577", http.StatusNotFound},
+		{"/bytes/-1", http.StatusNotFound},
+		{"/bytes/x", http.StatusNotFound},
+		{"/bytes/10?seed=x", http.StatusBadRequest},
+		{"/stream-bytes/10?chunk_size=0", http.StatusBadRequest},
+		{"/stream-bytes/10?chunk_size=x", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		if res, _ := get(tc.path); res.StatusCode != tc.wantCode {
+			t.Fatalf("GET %s returned status %d, expected %d", tc.path, res.StatusCode, tc.wantCode)
+		}
+	}
+}
+
+func TestServeStream(t *testing.T) {
+	s := httptest.NewServer(handy.ServeStream(100))
+	defer s.Close()
+
+	read := func(path string) []handy.StreamLine {
+		res, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error on GET %s: %+v", path, err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("GET %s returned status %d, content type %q", path, res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		var lines []handy.StreamLine
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			var line handy.StreamLine
+			if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+				t.Fatalf("unexpected error decoding line %q: %+v", sc.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	lines := read("/stream/5?seed=7")
+	if len(lines) != 5 {
+		t.Fatalf("streamed %d lines, expected 5", len(lines))
+	}
+	for i, line := range lines {
+		if line.ID != i || len(line.Data) != 32 {
+			t.Fatalf("line %d is %+v, expected id %d and 16 bytes of hex data", i, line, i)
+		}
+	}
+	again := read("/stream/5?seed=7")
+	for i := range lines {
+		if again[i] != lines[i] {
+			t.Fatalf("line %d differs for the same seed: %+v and %+v", i, lines[i], again[i])
+		}
+	}
+	if other := read("/stream/5?seed=8"); other[0] == lines[0] {
+		t.Fatalf("first line is the same for different seeds")
+	}
+
+	res, err := http.Get(s.URL + "/stream/101")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("streaming too many lines returned status %d, expected 404", res.StatusCode)
+	}
+}
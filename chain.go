@@ -0,0 +1,150 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RedirectChainOptions configures the handler returned by ServeRedirectChain.
+type RedirectChainOptions struct {
+	// Code is the status code of each hop without one given by the
+	// request: one of 301, 302, 303, 307, or 308. If zero, 302 Found is
+	// used.
+	Code int
+
+	// Absolute makes each Location an absolute URL, rather than just a
+	// path, unless the request says otherwise.
+	Absolute bool
+
+	// MaxHops is the longest chain served. Requests for more are not
+	// found. If zero, 100 is used.
+	MaxHops int
+
+	// Final handles the request at the end of the chain. If nil, it is
+	// answered with 200 OK.
+	Final http.Handler
+}
+
+// ServeRedirectChain provides a handler that redirects a request through the
+// number of hops indicated by the last element of the path before it lands on
+// a final response, so it may be mounted under any prefix. Each hop
+// redirects to the same path with the last element one less, so that
+//
+//	/redirect/3 -> /redirect/2 -> /redirect/1 -> /redirect/0
+//
+// where /redirect/0 is handled by opts.Final. The request may choose an
+// absolute or relative Location with the absolute query parameter, and the
+// status code of each hop with the status parameter, a comma separated list
+// used in order with the last code repeated:
+//
+//	/redirect/5?absolute=true&status=301,307,308
+//
+// ServeRedirectChain panics if opts.Code is not a redirect code.
+func ServeRedirectChain(opts RedirectChainOptions) http.Handler {
+	code := opts.Code
+	if code == 0 {
+		code = http.StatusFound
+	}
+	if !isRedirectCode(code) {
+		panic(fmt.Sprintf("handy: invalid redirect code %d", code))
+	}
+	maxHops := opts.MaxHops
+	if maxHops == 0 {
+		maxHops = 100
+	}
+	final := opts.Final
+	if final == nil {
+		final = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeCode(w, r, http.StatusOK)
+		})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hopsString := lastPathElement(r)
+		hops, err := strconv.Atoi(hopsString)
+		if err != nil || hops < 0 || hops > maxHops {
+			http.NotFound(w, r)
+			return
+		}
+		if hops == 0 {
+			final.ServeHTTP(w, r)
+			return
+		}
+		query := r.URL.Query()
+		absolute := opts.Absolute
+		if s := query.Get("absolute"); s != "" {
+			if absolute, err = strconv.ParseBool(s); err != nil {
+				badRequest(w, r)
+				return
+			}
+		}
+		hopCode := code
+		if s := query.Get("status"); s != "" {
+			codes := strings.Split(s, ",")
+			if hopCode, err = strconv.Atoi(strings.TrimSpace(codes[0])); err != nil || !isRedirectCode(hopCode) {
+				badRequest(w, r)
+				return
+			}
+			if len(codes) > 1 {
+				query.Set("status", strings.Join(codes[1:], ","))
+			}
+		}
+
+		p := strings.TrimSuffix(r.URL.Path, "/")
+		next := url.URL{Path: p[:strings.LastIndex(p, "/")+1] + strconv.Itoa(hops-1), RawQuery: query.Encode()}
+		if absolute {
+			next.Scheme, next.Host = requestScheme(r), r.Host
+		}
+		writeRedirect(w, r, next.String(), hopCode)
+	})
+}
+
+// ServeRedirectTo provides a handler that redirects to the URL given by the
+// url query parameter, with the status code given by the status parameter,
+// one of 301, 302, 303, 307, or 308, or 302 Found if there is none.
+//
+//	/redirect-to?url=https://example.com/&status=307
+func ServeRedirectTo() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		location := query.Get("url")
+		code := http.StatusFound
+		if s := query.Get("status"); s != "" {
+			var err error
+			if code, err = strconv.Atoi(s); err != nil || !isRedirectCode(code) {
+				badRequest(w, r)
+				return
+			}
+		}
+		if location == "" {
+			badRequest(w, r)
+			return
+		}
+		writeRedirect(w, r, location, code)
+	})
+}
+
+// writeRedirect responds with code and the Location header set to location
+// exactly as given, unlike http.Redirect, which makes it absolute.
+func writeRedirect(w http.ResponseWriter, r *http.Request, location string, code int) {
+	w.Header().Set("Location", location)
+	writeCode(w, r, code)
+}
+
+// badRequest responds with 400 Bad Request.
+func badRequest(w http.ResponseWriter, r *http.Request) {
+	writeCode(w, r, http.StatusBadRequest)
+}
+
+// requestScheme returns the scheme used to make r.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,149 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestServeRedirectChain(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/redirect/", handy.ServeRedirectChain(handy.RedirectChainOptions{MaxHops: 10}))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	testCases := []struct {
+		name      string
+		path      string
+		maxHops   int
+		wantCodes []int
+		wantErr   bool
+	}{
+		{"no hops", "/redirect/0", 10, nil, false},
+		{"five hops", "/redirect/5", 10, []int{302, 302, 302, 302, 302}, false},
+		{"absolute", "/redirect/2?absolute=true", 10, []int{302, 302}, false},
+		{"codes", "/redirect/4?status=301,307", 10, []int{301, 307, 307, 307}, false},
+		{"client limit", "/redirect/5", 3, []int{302, 302, 302}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var codes []int
+			c := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					if len(via) > tc.maxHops {
+						return errors.New("too many redirects")
+					}
+					codes = append(codes, req.Response.StatusCode)
+					return nil
+				},
+			}
+			res, err := c.Get(s.URL + tc.path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("request returned error %v, expected error %t", err, tc.wantErr)
+			}
+			if err == nil {
+				defer res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					t.Fatalf("chain ended with status %d, expected 200", res.StatusCode)
+				}
+				if !strings.HasSuffix(res.Request.URL.Path, "/redirect/0") {
+					t.Fatalf("chain ended at %q, expected /redirect/0", res.Request.URL.Path)
+				}
+			}
+			if len(codes) != len(tc.wantCodes) {
+				t.Fatalf("chain had hops %v, expected %v", codes, tc.wantCodes)
+			}
+			for i := range codes {
+				if codes[i] != tc.wantCodes[i] {
+					t.Fatalf("chain had hops %v, expected %v", codes, tc.wantCodes)
+				}
+			}
+		})
+	}
+}
+
+func TestServeRedirectChainLocation(t *testing.T) {
+	h := handy.ServeRedirectChain(handy.RedirectChainOptions{Code: http.StatusTemporaryRedirect, MaxHops: 10})
+
+	testCases := []struct {
+		url          string
+		wantCode     int
+		wantLocation string
+	}{
+		{"http://example.com/redirect/3", http.StatusTemporaryRedirect, "/redirect/2"},
+		{"http://example.com/a/b/3/", http.StatusTemporaryRedirect, "/a/b/2"},
+		{"http://example.com/redirect/3?absolute=1&x=y", http.StatusTemporaryRedirect, "http://example.com/redirect/2?absolute=1&x=y"},
+		{"https://example.com/redirect/3?absolute=true", http.StatusTemporaryRedirect, "https://example.com/redirect/2?absolute=true"},
+		{"http://example.com/redirect/3?status=308", http.StatusPermanentRedirect, "/redirect/2?status=308"},
+		{"http://example.com/redirect/3?status=301,302,303", http.StatusMovedPermanently, "/redirect/2?status=302%2C303"},
+		{"http://example.com/redirect/0", http.StatusOK, ""},
+		{"http://example.com/redirect/11", http.StatusNotFound, ""},
+		{"http://example.com/redirect/-1", http.StatusNotFound, ""},
+		{"http://example.com/redirect/x", http.StatusNotFound, ""},
+		{"http://example.com/redirect/3?status=200", http.StatusBadRequest, ""},
+		{"http://example.com/redirect/3?status=304", http.StatusBadRequest, ""},
+		{"http://example.com/redirect/3?status=305", http.StatusBadRequest, ""},
+		{"http://example.com/redirect/3?absolute=maybe", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+			if w.Code != tc.wantCode {
+				t.Fatalf("request returned status %d, expected %d", w.Code, tc.wantCode)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantLocation {
+				t.Fatalf("request redirected to %q, expected %q", got, tc.wantLocation)
+			}
+		})
+	}
+}
+
+func TestServeRedirectTo(t *testing.T) {
+	h := handy.ServeRedirectTo()
+
+	testCases := []struct {
+		url          string
+		wantCode     int
+		wantLocation string
+	}{
+		{"/redirect-to?url=https://example.com/x", http.StatusFound, "https://example.com/x"},
+		{"/redirect-to?url=other&status=307", http.StatusTemporaryRedirect, "other"},
+		{"/redirect-to?url=/x&status=304", http.StatusBadRequest, ""},
+		{"/redirect-to?url=/x&status=399", http.StatusBadRequest, ""},
+		{"/redirect-to?status=302", http.StatusBadRequest, ""},
+		{"/redirect-to?url=/x&status=404", http.StatusBadRequest, ""},
+		{"/redirect-to?url=/x&status=x", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+			if w.Code != tc.wantCode {
+				t.Fatalf("request returned status %d, expected %d", w.Code, tc.wantCode)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantLocation {
+				t.Fatalf("request redirected to %q, expected %q", got, tc.wantLocation)
+			}
+		})
+	}
+}
+
+func TestServeRedirectChainInvalidCode(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic for invalid redirect code")
+		}
+	}()
+	handy.ServeRedirectChain(handy.RedirectChainOptions{Code: http.StatusNotModified})
+}
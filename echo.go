@@ -0,0 +1,152 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
+
+// maxEchoBody is the largest request body echoed.
+const maxEchoBody = 10 << 20
+
+// EchoRequest is the description of a request served by ServeEcho.
+type EchoRequest struct {
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	Proto      string `json:"proto"`
+	Host       string `json:"host"`
+	RemoteAddr string `json:"remote_addr"`
+
+	Headers map[string][]string `json:"headers"`
+	Query   map[string][]string `json:"query"`
+	Cookies map[string]string   `json:"cookies"`
+
+	// Form holds the fields of a URL encoded or multipart form body, and
+	// Files the names of the files uploaded in a multipart form.
+	Form  map[string][]string `json:"form"`
+	Files map[string][]string `json:"files"`
+
+	// Body is the request body, base64 encoded with BodyEncoding set to
+	// base64 if it is not valid UTF-8.
+	Body         string `json:"body"`
+	BodyEncoding string `json:"body_encoding,omitempty"`
+
+	TLS *EchoTLS `json:"tls,omitempty"`
+}
+
+// EchoTLS describes the TLS connection a request was made over.
+type EchoTLS struct {
+	Version            string `json:"version"`
+	CipherSuite        uint16 `json:"cipher_suite"`
+	ServerName         string `json:"server_name"`
+	NegotiatedProtocol string `json:"negotiated_protocol"`
+}
+
+// ServeEcho provides a handler that responds with a JSON EchoRequest
+// describing the request it was sent. Bodies larger than 10MiB are refused
+// with 413 Request Entity Too Large.
+func ServeEcho() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxEchoBody+1))
+		if err != nil {
+			badRequest(w, r)
+			return
+		}
+		if len(body) > maxEchoBody {
+			writeCode(w, r, http.StatusRequestEntityTooLarge)
+			return
+		}
+		echo := newEchoRequest(r, body)
+		out, err := json.MarshalIndent(echo, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, '\n')
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+		if r.Method != http.MethodHead {
+			w.Write(out)
+		}
+	})
+}
+
+// newEchoRequest describes r, whose body has already been read.
+func newEchoRequest(r *http.Request, body []byte) *EchoRequest {
+	echo := &EchoRequest{
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Proto:      r.Proto,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    r.Header,
+		Query:      r.URL.Query(),
+		Cookies:    make(map[string]string),
+		Form:       make(map[string][]string),
+		Files:      make(map[string][]string),
+	}
+	for _, c := range r.Cookies() {
+		echo.Cookies[c.Name] = c.Value
+	}
+
+	// a malformed form is still echoed as the body
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ParseMultipartForm(maxEchoBody)
+	for k, v := range r.PostForm {
+		echo.Form[k] = v
+	}
+	if r.MultipartForm != nil {
+		for k, v := range r.MultipartForm.Value {
+			echo.Form[k] = v
+		}
+		for k, files := range r.MultipartForm.File {
+			for _, f := range files {
+				echo.Files[k] = append(echo.Files[k], f.Filename)
+			}
+		}
+		r.MultipartForm.RemoveAll()
+	}
+
+	if utf8.Valid(body) {
+		echo.Body = string(body)
+	} else {
+		echo.Body = base64.StdEncoding.EncodeToString(body)
+		echo.BodyEncoding = "base64"
+	}
+
+	if r.TLS != nil {
+		echo.TLS = &EchoTLS{
+			Version:            tlsVersionName(r.TLS.Version),
+			CipherSuite:        r.TLS.CipherSuite,
+			ServerName:         r.TLS.ServerName,
+			NegotiatedProtocol: r.TLS.NegotiatedProtocol,
+		}
+	}
+	return echo
+}
+
+// tlsVersionName returns the name of a TLS version.
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionSSL30:
+		return "SSL 3.0"
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case 0x0304:
+		return "TLS 1.3"
+	}
+	return "0x" + strconv.FormatUint(uint64(version), 16)
+}
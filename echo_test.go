@@ -0,0 +1,135 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestServeEcho(t *testing.T) {
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	mw.WriteField("name", "gopher")
+	fw, _ := mw.CreateFormFile("upload", "notes.txt")
+	fw.Write([]byte("hello"))
+	mw.Close()
+
+	testCases := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        []byte
+		check       func(t *testing.T, echo handy.EchoRequest)
+	}{
+		{"query and headers", "GET", "/echo?a=1&a=2&b=3", "", nil, func(t *testing.T, echo handy.EchoRequest) {
+			if echo.Method != "GET" || echo.URL != "/echo?a=1&a=2&b=3" || echo.Proto != "HTTP/1.1" || echo.Host != "example.com" {
+				t.Fatalf("unexpected request line %+v", echo)
+			}
+			if want := map[string][]string{"a": {"1", "2"}, "b": {"3"}}; !reflect.DeepEqual(echo.Query, want) {
+				t.Fatalf("query %v, expected %v", echo.Query, want)
+			}
+			if got := echo.Headers["X-Test"]; !reflect.DeepEqual(got, []string{"yes"}) {
+				t.Fatalf("X-Test header %v, expected [yes]", got)
+			}
+			if want := map[string]string{"session": "abc", "theme": "dark"}; !reflect.DeepEqual(echo.Cookies, want) {
+				t.Fatalf("cookies %v, expected %v", echo.Cookies, want)
+			}
+			if echo.RemoteAddr != "192.0.2.1:1234" {
+				t.Fatalf("remote addr %q, expected 192.0.2.1:1234", echo.RemoteAddr)
+			}
+		}},
+		{"form", "POST", "/echo", "application/x-www-form-urlencoded", []byte("x=1&y=2"), func(t *testing.T, echo handy.EchoRequest) {
+			if want := map[string][]string{"x": {"1"}, "y": {"2"}}; !reflect.DeepEqual(echo.Form, want) {
+				t.Fatalf("form %v, expected %v", echo.Form, want)
+			}
+			if echo.Body != "x=1&y=2" || echo.BodyEncoding != "" {
+				t.Fatalf("body %q encoded %q, expected the form", echo.Body, echo.BodyEncoding)
+			}
+		}},
+		{"multipart", "POST", "/echo", mw.FormDataContentType(), multipartBody.Bytes(), func(t *testing.T, echo handy.EchoRequest) {
+			if want := map[string][]string{"name": {"gopher"}}; !reflect.DeepEqual(echo.Form, want) {
+				t.Fatalf("form %v, expected %v", echo.Form, want)
+			}
+			if want := map[string][]string{"upload": {"notes.txt"}}; !reflect.DeepEqual(echo.Files, want) {
+				t.Fatalf("files %v, expected %v", echo.Files, want)
+			}
+			if !strings.Contains(echo.Body, "hello") {
+				t.Fatalf("body %q, expected the multipart form", echo.Body)
+			}
+		}},
+		{"binary", "PUT", "/echo", "application/octet-stream", []byte{0xff, 0x00, 0xfe}, func(t *testing.T, echo handy.EchoRequest) {
+			if echo.Body != "/wD+" || echo.BodyEncoding != "base64" {
+				t.Fatalf("body %q encoded %q, expected /wD+ encoded base64", echo.Body, echo.BodyEncoding)
+			}
+		}},
+	}
+
+	h := handy.ServeEcho()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.url, bytes.NewReader(tc.body))
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set("X-Test", "yes")
+			r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+			r.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("request returned status %d, expected 200", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("response has content type %q, expected application/json", ct)
+			}
+			var echo handy.EchoRequest
+			if err := json.Unmarshal(w.Body.Bytes(), &echo); err != nil {
+				t.Fatalf("unexpected error decoding response: %+v", err)
+			}
+			if echo.TLS != nil {
+				t.Fatalf("unexpected TLS info %+v for plain request", echo.TLS)
+			}
+			tc.check(t, echo)
+		})
+	}
+}
+
+func TestServeEchoTLS(t *testing.T) {
+	s := httptest.NewTLSServer(handy.ServeWithDelay(handy.ServeEcho()))
+	defer s.Close()
+	res, err := s.Client().Get(s.URL + "/echo/10ms")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	defer res.Body.Close()
+	var echo handy.EchoRequest
+	if err := json.NewDecoder(res.Body).Decode(&echo); err != nil {
+		t.Fatalf("unexpected error decoding response: %+v", err)
+	}
+	if echo.URL != "/echo" {
+		t.Fatalf("echoed url %q, expected /echo after the delay", echo.URL)
+	}
+	if echo.TLS == nil || !strings.HasPrefix(echo.TLS.Version, "TLS") || echo.TLS.CipherSuite == 0 {
+		t.Fatalf("unexpected TLS info %+v", echo.TLS)
+	}
+}
+
+func TestServeEchoTooLarge(t *testing.T) {
+	w := httptest.NewRecorder()
+	handy.ServeEcho().ServeHTTP(w, httptest.NewRequest("POST", "/echo", bytes.NewReader(make([]byte, 10<<20+1))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("request returned status %d, expected 413", w.Code)
+	}
+}
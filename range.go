@@ -0,0 +1,72 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// rangeModTime is the fixed modification time reported for range payloads,
+// so that If-Range and conditional requests are deterministic.
+var rangeModTime = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// ServeRange provides a handler that serves a deterministic payload with the
+// number of bytes indicated by the last element of the path. The payload
+// repeats the lowercase alphabet, so byte i is 'a'+i%26. Range and If-Range
+// headers are honored, with single and multipart/byteranges responses, and
+// 416 Requested Range Not Satisfiable for ranges outside the payload.
+// Sizes that are negative or larger than maxSize are not found.
+func ServeRange(maxSize int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sizeString := lastPathElement(r)
+		size, err := strconv.ParseInt(sizeString, 10, 64)
+		if err != nil || size < 0 || size > maxSize {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", `"range-`+sizeString+`"`)
+		http.ServeContent(w, r, "", rangeModTime, &alphabetReader{size: size})
+	})
+}
+
+// alphabetReader is an io.ReadSeeker over size bytes of repeating alphabet.
+type alphabetReader struct {
+	size, off int64
+}
+
+func (ar *alphabetReader) Read(p []byte) (int, error) {
+	if ar.off >= ar.size {
+		return 0, io.EOF
+	}
+	if remaining := ar.size - ar.off; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	for i := range p {
+		p[i] = 'a' + byte((ar.off+int64(i))%26)
+	}
+	ar.off += int64(len(p))
+	return len(p), nil
+}
+
+func (ar *alphabetReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += ar.off
+	case io.SeekEnd:
+		offset += ar.size
+	default:
+		return 0, errors.New("handy: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("handy: negative position")
+	}
+	ar.off = offset
+	return offset, nil
+}
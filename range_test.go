@@ -0,0 +1,200 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestServeRange(t *testing.T) {
+	s := httptest.NewServer(handy.ServeRange(1024))
+	defer s.Close()
+
+	testCases := []struct {
+		name             string
+		path             string
+		header           http.Header
+		wantCode         int
+		wantContentRange string
+		wantBody         string
+	}{
+		{"full payload",
+			"/30",
+			nil,
+			http.StatusOK,
+			"",
+			"abcdefghijklmnopqrstuvwxyzabcd",
+		},
+		{"empty payload",
+			"/0",
+			nil,
+			http.StatusOK,
+			"",
+			"",
+		},
+		{"mounted",
+			"/range/3",
+			nil,
+			http.StatusOK,
+			"",
+			"abc",
+		},
+		{"single range",
+			"/100",
+			http.Header{"Range": {"bytes=25-28"}},
+			http.StatusPartialContent,
+			"bytes 25-28/100",
+			"zabc",
+		},
+		{"suffix range",
+			"/100",
+			http.Header{"Range": {"bytes=-2"}},
+			http.StatusPartialContent,
+			"bytes 98-99/100",
+			"uv",
+		},
+		{"open range",
+			"/28",
+			http.Header{"Range": {"bytes=26-"}},
+			http.StatusPartialContent,
+			"bytes 26-27/28",
+			"ab",
+		},
+		{"unsatisfiable range",
+			"/10",
+			http.Header{"Range": {"bytes=20-30"}},
+			http.StatusRequestedRangeNotSatisfiable,
+			"bytes */10",
+			"",
+		},
+		{"matching If-Range",
+			"/10",
+			http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"range-10"`}},
+			http.StatusPartialContent,
+			"bytes 0-1/10",
+			"ab",
+		},
+		{"stale If-Range",
+			"/10",
+			http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"range-11"`}},
+			http.StatusOK,
+			"",
+			"abcdefghij",
+		},
+		{"too large",
+			"/1025",
+			nil,
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+		{"negative",
+			"/-1",
+			nil,
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+		{"not a size",
+			"/foo",
+			nil,
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, s.URL+tc.path, nil)
+			if err != nil {
+				t.Fatalf("constructing request: %+v", err)
+			}
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("request to %q returned status code %03d, expected %03d", tc.path, res.StatusCode, tc.wantCode)
+			}
+			if res.Header.Get("Content-Range") != tc.wantContentRange {
+				t.Fatalf("request to %q returned Content-Range %q, expected %q", tc.path, res.Header.Get("Content-Range"), tc.wantContentRange)
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("reading response body: %+v", err)
+			}
+			if tc.wantCode != http.StatusRequestedRangeNotSatisfiable && string(body) != tc.wantBody {
+				t.Fatalf("request to %q returned body %q, expected %q", tc.path, body, tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestServeRangeMultipart(t *testing.T) {
+	s := httptest.NewServer(handy.ServeRange(1024))
+	defer s.Close()
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/52", nil)
+	if err != nil {
+		t.Fatalf("constructing request: %+v", err)
+	}
+	req.Header.Set("Range", "bytes=0-2,26-28")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("doing request: %+v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("returned status code %03d, expected %03d", res.StatusCode, http.StatusPartialContent)
+	}
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("parsing content type: %+v", err)
+	}
+	if mediaType != "multipart/byteranges" {
+		t.Fatalf("returned content type %q, expected %q", mediaType, "multipart/byteranges")
+	}
+
+	wantParts := []struct {
+		contentRange string
+		body         []byte
+	}{
+		{"bytes 0-2/52", []byte("abc")},
+		{"bytes 26-28/52", []byte("abc")},
+	}
+	mr := multipart.NewReader(res.Body, params["boundary"])
+	for i, want := range wantParts {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("reading part %d: %+v", i, err)
+		}
+		if part.Header.Get("Content-Range") != want.contentRange {
+			t.Fatalf("part %d has Content-Range %q, expected %q", i, part.Header.Get("Content-Range"), want.contentRange)
+		}
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatalf("reading part %d body: %+v", i, err)
+		}
+		if !bytes.Equal(body, want.body) {
+			t.Fatalf("part %d has body %q, expected %q", i, body, want.body)
+		}
+	}
+	if _, err := mr.NextPart(); err == nil {
+		t.Fatalf("expected only %d parts", len(wantParts))
+	}
+}
@@ -0,0 +1,140 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// StatusHit identifies a kind of response counted by a StatusRecorder.
+type StatusHit struct {
+	Code   int    `json:"code"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Client string `json:"client"`
+}
+
+// StatusCount is the number of responses recorded for a StatusHit.
+type StatusCount struct {
+	StatusHit
+	Count int `json:"count"`
+}
+
+// StatusRecorder counts the responses served by a ServeStatus handler. It is
+// also an http.Handler, responding to GET with the counts as JSON, and to
+// DELETE by resetting them. The zero value is ready to use.
+type StatusRecorder struct {
+	mu     sync.Mutex
+	counts map[StatusHit]int
+}
+
+// Counts returns a copy of the current counts.
+func (sr *StatusRecorder) Counts() map[StatusHit]int {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	counts := make(map[StatusHit]int, len(sr.counts))
+	for hit, n := range sr.counts {
+		counts[hit] = n
+	}
+	return counts
+}
+
+// Reset discards all counts.
+func (sr *StatusRecorder) Reset() {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.counts = nil
+}
+
+func (sr *StatusRecorder) record(hit StatusHit) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.counts == nil {
+		sr.counts = make(map[StatusHit]int)
+	}
+	sr.counts[hit]++
+}
+
+// ServeHTTP serves the counts as a JSON array ordered by code, path, method,
+// and client.
+func (sr *StatusRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodDelete:
+		sr.Reset()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	counts := []StatusCount{}
+	for hit, n := range sr.Counts() {
+		counts = append(counts, StatusCount{hit, n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		switch {
+		case a.Code != b.Code:
+			return a.Code < b.Code
+		case a.Path != b.Path:
+			return a.Path < b.Path
+		case a.Method != b.Method:
+			return a.Method < b.Method
+		}
+		return a.Client < b.Client
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// Record wraps next so that every response it writes is counted.
+func (sr *StatusRecorder) Record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		sr.record(StatusHit{
+			Code:   sw.status(),
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Client: client,
+		})
+	})
+}
+
+// statusWriter remembers the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.code == 0 {
+		sw.code = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.code == 0 {
+		sw.code = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *statusWriter) status() int {
+	if sw.code == 0 {
+		return http.StatusOK
+	}
+	return sw.code
+}
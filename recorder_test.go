@@ -0,0 +1,94 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	rec := new(handy.StatusRecorder)
+	mux := http.NewServeMux()
+	mux.Handle("/status/", handy.ServeStatusWithOptions(handy.StatusOptions{Recorder: rec}))
+	mux.Handle("/counts", rec)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/status/200"},
+		{http.MethodGet, "/status/200"},
+		{http.MethodPost, "/status/200"},
+		{http.MethodGet, "/status/503"},
+		{http.MethodGet, "/status/foo"},
+		{http.MethodHead, "/status/204"},
+	}
+	for _, rr := range requests {
+		req, err := http.NewRequest(rr.method, s.URL+rr.path, nil)
+		if err != nil {
+			t.Fatalf("constructing request: %+v", err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("doing request: %+v", err)
+		}
+		res.Body.Close()
+	}
+
+	client := "127.0.0.1"
+	wantCounts := map[handy.StatusHit]int{
+		{Code: http.StatusOK, Method: http.MethodGet, Path: "/status/200", Client: client}:                 2,
+		{Code: http.StatusOK, Method: http.MethodPost, Path: "/status/200", Client: client}:                1,
+		{Code: http.StatusServiceUnavailable, Method: http.MethodGet, Path: "/status/503", Client: client}: 1,
+		{Code: http.StatusNotFound, Method: http.MethodGet, Path: "/status/foo", Client: client}:           1,
+		{Code: http.StatusNoContent, Method: http.MethodHead, Path: "/status/204", Client: client}:         1,
+	}
+	if got := rec.Counts(); !reflect.DeepEqual(got, wantCounts) {
+		t.Fatalf("recorded counts %+v, expected %+v", got, wantCounts)
+	}
+
+	res, err := http.Get(s.URL + "/counts")
+	if err != nil {
+		t.Fatalf("getting counts: %+v", err)
+	}
+	defer res.Body.Close()
+	var got []handy.StatusCount
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding counts: %+v", err)
+	}
+	want := []handy.StatusCount{
+		{StatusHit: handy.StatusHit{Code: http.StatusOK, Method: http.MethodGet, Path: "/status/200", Client: client}, Count: 2},
+		{StatusHit: handy.StatusHit{Code: http.StatusOK, Method: http.MethodPost, Path: "/status/200", Client: client}, Count: 1},
+		{StatusHit: handy.StatusHit{Code: http.StatusNoContent, Method: http.MethodHead, Path: "/status/204", Client: client}, Count: 1},
+		{StatusHit: handy.StatusHit{Code: http.StatusNotFound, Method: http.MethodGet, Path: "/status/foo", Client: client}, Count: 1},
+		{StatusHit: handy.StatusHit{Code: http.StatusServiceUnavailable, Method: http.MethodGet, Path: "/status/503", Client: client}, Count: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("served counts %+v, expected %+v", got, want)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, s.URL+"/counts", nil)
+	if err != nil {
+		t.Fatalf("constructing request: %+v", err)
+	}
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("resetting counts: %+v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("reset returned status code %03d, expected %03d", res.StatusCode, http.StatusNoContent)
+	}
+	if got := rec.Counts(); len(got) != 0 {
+		t.Fatalf("recorded counts %+v after reset, expected none", got)
+	}
+}
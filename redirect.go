@@ -4,38 +4,474 @@
 package handy
 
 import (
+	"fmt"
 	"net/http"
 	"sync"
+	"time"
 )
 
-type permanentHandler struct {
-	redirects map[string]string
-	sync.RWMutex
+// Redirect is the destination of a single redirect.
+type Redirect struct {
+	// URL is where requests are redirected.
+	URL string `json:"url"`
+
+	// Code is the redirect status code: one of 301, 302, 303, 307, or
+	// 308. If zero, the handler's default is used.
+	Code int `json:"code,omitempty"`
+
+	// Query controls what becomes of the request query string. If zero,
+	// the handler's default is used.
+	Query QueryPolicy `json:"query,omitempty"`
+
+	// NotBefore and NotAfter, unless zero, limit the redirect to requests
+	// from NotBefore until just before NotAfter. At other times requests
+	// are handled as if the redirect did not exist.
+	NotBefore time.Time `json:"not_before,omitempty"`
+	NotAfter  time.Time `json:"not_after,omitempty"`
+}
+
+// RegexpRedirect redirects any request with a path matching Pattern. The URL
+// may refer to submatches of Pattern as in regexp.Regexp.Expand, so that
+//
+//	RegexpRedirect{Pattern: `^/user/(\d+)/profile$`, Redirect: Redirect{URL: "/profiles/$1"}}
+//
+// redirects /user/42/profile to /profiles/42.
+type RegexpRedirect struct {
+	Pattern string `json:"pattern"`
+	Redirect
+}
+
+// RedirectOptions configures the handler returned by ServeRedirects.
+type RedirectOptions struct {
+	// Code is the status code used for any Redirect without one. If zero,
+	// 301 Moved Permanently is used.
+	Code int
+
+	// Regexps are tried in order for any request not matched by the
+	// redirects map.
+	Regexps []RegexpRedirect
+
+	// Query is the policy used for any Redirect without one. If zero,
+	// the request query is dropped.
+	Query QueryPolicy
+
+	// Next handles any request that is not redirected. If nil,
+	// http.NotFound is used.
+	Next http.Handler
+
+	// Flatten redirects any request for an exact source that starts a
+	// chain of redirects straight to the end of the chain. The table is
+	// kept as given, so changing any redirect along the way changes where
+	// the chain ends.
+	Flatten bool
+
+	// Stats enables counting the requests redirected by each rule, as
+	// reported by RedirectHandler.Stats.
+	Stats bool
+
+	// Samples is the number of referrers and user agents sampled for
+	// each rule when Stats is enabled.
+	Samples int
+
+	// Store persists changes to the redirect table. If it holds any
+	// redirects, they are loaded in place of those given to the handler,
+	// which otherwise seed the store.
+	Store RedirectStore
+
+	// Clock tells the time for scheduled redirects and statistics. If
+	// nil, time.Now is used.
+	Clock func() time.Time
+
+	// IgnoreCase matches paths without regard to case. The rest of the
+	// path added by a prefix rule keeps its case, and regular expressions
+	// see the path as requested, so should use (?i) as needed.
+	IgnoreCase bool
+
+	// IgnoreTrailingSlash matches exact sources whether or not either
+	// the source or the request path ends in a slash.
+	IgnoreTrailingSlash bool
+
+	// DecodeSources percent-decodes the path of each source, so that
+	// /caf%C3%A9 matches requests for /café as well as /caf%C3%A9.
+	DecodeSources bool
+
+	// CollapseSlashes treats each run of slashes in sources and request
+	// paths as a single slash.
+	CollapseSlashes bool
+}
+
+// RedirectHandler is an http.Handler that redirects requests according to a
+// table that may be changed at any time, even while serving requests.
+type RedirectHandler struct {
+	mu      sync.RWMutex
+	rules   redirectRules
+	code    int
+	query   QueryPolicy
+	next    http.Handler
+	flatten bool
+	stats   *redirectStats
+	store   RedirectStore
+	clock   func() time.Time
+	norm    pathNormalization
 }
 
 // ServePermanentRedirects provides an http.Handler that will permanently redirect
 // any requests based on the redirects map
-//     redirects[requestedURL] = redirectedURL
+//
+//	redirects[requestedURL] = redirectedURL
+//
+// Each requested URL is matched exactly against the request path; the
+// patterns and host rules of ServeRedirects are not supported, so one that
+// does not start with / never matches. Redirect loops are not checked for.
 func ServePermanentRedirects(redirects map[string]string) http.Handler {
-	h := new(permanentHandler)
-	h.init(redirects)
-	return http.Handler(h)
+	rules := redirectRules{
+		redirects: make(map[string]Redirect, len(redirects)),
+		patterns:  newPatternIndex(),
+		hosts:     make(map[string]int),
+	}
+	for from, to := range redirects {
+		rules.redirects[from] = Redirect{URL: to}
+	}
+	return &RedirectHandler{rules: rules, code: http.StatusMovedPermanently, next: http.NotFoundHandler(), clock: time.Now}
+}
+
+// ServeRedirects provides a RedirectHandler that will redirect any requests
+// based on the redirects map
+//
+//	redirects[requestedURL] = Redirect{URL: redirectedURL, Code: code}
+//
+// A requested URL may also be a pattern. One ending in * is a prefix, and the
+// rest of the path replaces a * ending the redirected URL
+//
+//	redirects["/docs/v1/*"] = Redirect{URL: "/documentation/*"}
+//
+// while any other containing *, ?, or [ is matched with path.Match.
+//
+// A requested URL that does not start with / is limited to a host, which may
+// be a wildcard matching any subdomain
+//
+//	redirects["old.example.com/pricing"] = Redirect{URL: "https://example.com/plans"}
+//	redirects["*.example.com/login"] = Redirect{URL: "https://example.com/login"}
+//
+// and one with no path at all redirects every request to the host, keeping
+// the path and, unless the Redirect says otherwise, the query
+//
+//	redirects["www.example.com"] = Redirect{URL: "https://example.com"}
+//
+// Hosts are matched without regard to case or port. Exact matches for the
+// host are preferred, then exact matches for any host, the longest matching
+// pattern, the first matching opts.Regexps, and finally redirects for the
+// whole host.
+//
+// ServeRedirects panics if any status code is not a redirect code, or any
+// pattern or regular expression is malformed.
+func ServeRedirects(redirects map[string]Redirect, opts RedirectOptions) *RedirectHandler {
+	h, err := NewRedirectHandler(redirects, opts)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// RedirectMiddleware provides a RedirectHandler that will redirect any
+// requests based on the redirects map, as ServeRedirects does, and pass any
+// other request on to next.
+func RedirectMiddleware(redirects map[string]Redirect, next http.Handler) *RedirectHandler {
+	return ServeRedirects(redirects, RedirectOptions{Next: next})
+}
+
+// NewRedirectHandler is like ServeRedirects, but returns an error rather
+// than panicking when given an invalid redirect.
+func NewRedirectHandler(redirects map[string]Redirect, opts RedirectOptions) (*RedirectHandler, error) {
+	code := opts.Code
+	if code == 0 {
+		code = http.StatusMovedPermanently
+	}
+	if !isRedirectCode(code) {
+		return nil, fmt.Errorf("handy: invalid default redirect code %d", code)
+	}
+	if opts.Query < QueryDefault || opts.Query > QueryOverride {
+		return nil, fmt.Errorf("handy: invalid default query policy %d", opts.Query)
+	}
+	next := opts.Next
+	if next == nil {
+		next = http.NotFoundHandler()
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	h := &RedirectHandler{code: code, query: opts.Query, next: next, flatten: opts.Flatten, clock: clock}
+	h.norm = pathNormalization{
+		ignoreCase:      opts.IgnoreCase,
+		trailingSlash:   opts.IgnoreTrailingSlash,
+		decode:          opts.DecodeSources,
+		collapseSlashes: opts.CollapseSlashes,
+	}
+	h.rules.norm = h.norm
+	if opts.Stats {
+		h.stats = newRedirectStats(opts.Samples)
+	}
+	if opts.Store != nil {
+		stored, err := opts.Store.Load()
+		if err != nil {
+			return nil, err
+		}
+		if len(stored) > 0 {
+			redirects = stored
+		} else {
+			h.store = opts.Store
+		}
+	}
+	if err := h.SetRegexps(opts.Regexps); err != nil {
+		return nil, err
+	}
+	if err := h.Replace(redirects); err != nil {
+		return nil, err
+	}
+	h.store = opts.Store
+	return h, nil
+}
+
+// Set adds or changes the redirect for requests to from. If the change
+// would create a redirect loop, a *RedirectLoopError is returned and the
+// table is left unchanged, as it is if the change cannot be stored.
+func (h *RedirectHandler) Set(from string, to Redirect) error {
+	from, err := h.norm.source(from)
+	if err != nil {
+		return err
+	}
+	if err := validateRedirect(from, to); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.set(from, to)
+}
+
+// set changes the redirect for the canonical source from, which has been
+// validated. h.mu must be held.
+func (h *RedirectHandler) set(from string, to Redirect) error {
+	prev, existed := h.rules.redirects[from]
+	h.rules.set(from, to)
+	var sources []string // only chains through from can have changed
+	if isExactRedirectSource(from) {
+		sources = []string{from}
+	}
+	err := h.rules.check(sources)
+	if err == nil && h.store != nil {
+		err = h.store.Set(from, to)
+	}
+	if err != nil {
+		if existed {
+			h.rules.set(from, prev)
+		} else {
+			h.rules.delete(from)
+		}
+		return err
+	}
+	if h.flatten {
+		h.rules.flatten()
+	}
+	return nil
 }
 
-func (h *permanentHandler) init(redirects map[string]string) {
-	h.Lock()
-	defer h.Unlock()
-	h.redirects = redirects
+// Delete removes the redirect for requests to from, if any. An error is
+// only returned if the change cannot be stored.
+func (h *RedirectHandler) Delete(from string) error {
+	from, err := h.norm.source(from)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delete(from)
+}
+
+// delete removes the redirect for the canonical source from. h.mu must be
+// held.
+func (h *RedirectHandler) delete(from string) error {
+	if h.store != nil {
+		if err := h.store.Delete(from); err != nil {
+			return err
+		}
+	}
+	h.rules.delete(from)
+	if h.flatten {
+		h.rules.flatten()
+	}
+	return nil
+}
+
+// Replace swaps the entire redirect table for a copy of redirects. If any
+// redirect is invalid, there is a redirect loop, or the change cannot be
+// stored, the table is left unchanged.
+func (h *RedirectHandler) Replace(redirects map[string]Redirect) error {
+	rules, err := newRedirectRules(redirects, h.norm)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.replace(rules)
+}
+
+// replace swaps the redirect table for that in rules, keeping the current
+// regular expressions. h.mu must be held.
+func (h *RedirectHandler) replace(rules redirectRules) error {
+	rules.regexps = h.rules.regexps
+	if err := rules.check(nil); err != nil {
+		return err
+	}
+	if h.store != nil {
+		if err := h.store.Replace(rules.redirects); err != nil {
+			return err
+		}
+	}
+	if h.flatten {
+		rules.flatten()
+	}
+	h.rules = rules
+	return nil
 }
 
-// Serve Permanent Redirects
-func (h *permanentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.RLock()
-	defer h.RUnlock()
-	url, ok := h.redirects[r.URL.Path]
+// Snapshot returns a copy of the current redirect table.
+func (h *RedirectHandler) Snapshot() map[string]Redirect {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	table := make(map[string]Redirect, len(h.rules.redirects))
+	for from, to := range h.rules.redirects {
+		table[from] = to
+	}
+	return table
+}
+
+// SetRegexps replaces the regular expression redirects, which are tried in
+// order after the redirects table. If any is invalid, or there would be a
+// redirect loop, none are replaced.
+func (h *RedirectHandler) SetRegexps(regexps []RegexpRedirect) error {
+	compiled, err := compileRegexpRedirects(regexps)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rules := h.rules
+	rules.regexps = newRegexpSet(compiled)
+	if err := rules.check(nil); err != nil {
+		return err
+	}
+	h.rules.regexps = rules.regexps
+	if h.flatten {
+		h.rules.flatten()
+	}
+	return nil
+}
+
+// Regexps returns a copy of the regular expression redirects.
+func (h *RedirectHandler) Regexps() []RegexpRedirect {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	regexps := make([]RegexpRedirect, len(h.rules.regexps.list))
+	for i, re := range h.rules.regexps.list {
+		regexps[i] = re.RegexpRedirect
+	}
+	return regexps
+}
+
+// Serve Redirects
+func (h *RedirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m, now, ok := h.lookup(r, h.stats != nil)
 	if !ok {
-		http.NotFound(w, r)
+		h.next.ServeHTTP(w, r)
 		return
 	}
-	http.Redirect(w, r, url, http.StatusMovedPermanently)
+	if h.stats != nil {
+		h.stats.record(m.rule, r, now)
+	}
+	url, code := h.target(r, m)
+	http.Redirect(w, r, url, code)
+}
+
+// Lookup reports where r would be redirected, and with which status code,
+// without serving it. The URL may be relative to that of r.
+func (h *RedirectHandler) Lookup(r *http.Request) (url string, code int, ok bool) {
+	m, _, ok := h.lookup(r, false)
+	if !ok {
+		return "", 0, false
+	}
+	url, code = h.target(r, m)
+	return url, code, true
+}
+
+// lookup finds the redirect for r, and the time it was found at. The clock
+// is only read if some redirect is scheduled, or timed is set; otherwise
+// the time is zero, which every redirect is active at.
+func (h *RedirectHandler) lookup(r *http.Request, timed bool) (redirectMatch, time.Time, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var now time.Time
+	if timed || h.rules.scheduled > 0 || h.rules.regexps.scheduled > 0 {
+		now = h.clock()
+	}
+	m, ok := h.rules.match(requestHost(r), r.URL.Path, now)
+	if dest, flat := h.rules.flat[m.rule]; ok && flat {
+		m.dest = dest
+	}
+	return m, now, ok
+}
+
+// target returns the URL and status code of the redirect for r.
+func (h *RedirectHandler) target(r *http.Request, m redirectMatch) (string, int) {
+	code := m.rd.Code
+	if code == 0 {
+		code = h.code
+	}
+	query := m.rd.Query
+	if query == QueryDefault {
+		query = h.query
+	}
+	return applyQuery(m.dest, r.URL, query), code
+}
+
+func validateRedirect(from string, to Redirect) error {
+	if err := validateRedirectTarget(from, to); err != nil {
+		return err
+	}
+	if _, urlPath := splitRedirectSource(from); urlPath == "" {
+		return validateHostRedirect(from, to)
+	}
+	if isRedirectPattern(from) {
+		if _, err := newRedirectPattern(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRedirectTarget checks the code and query policy of a redirect.
+func validateRedirectTarget(from string, to Redirect) error {
+	if to.Code != 0 && !isRedirectCode(to.Code) {
+		return fmt.Errorf("handy: invalid redirect code %d for %q", to.Code, from)
+	}
+	if to.Query < QueryDefault || to.Query > QueryOverride {
+		return fmt.Errorf("handy: invalid query policy %d for %q", to.Query, from)
+	}
+	if !to.NotBefore.IsZero() && !to.NotAfter.IsZero() && !to.NotAfter.After(to.NotBefore) {
+		return fmt.Errorf("handy: redirect for %q expires before it starts", from)
+	}
+	return nil
+}
+
+// isRedirectCode reports whether code may be used for a Redirect.
+func isRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently,
+		http.StatusFound,
+		http.StatusSeeOther,
+		http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
@@ -5,9 +5,13 @@ package handy_test
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/jessecarl/handy"
@@ -53,3 +57,585 @@ func TestServePermanentRedirects(t *testing.T) {
 		t.Error("Expected Redirection")
 	}
 }
+
+func TestServePermanentRedirectsExact(t *testing.T) {
+	h := handy.ServePermanentRedirects(map[string]string{
+		"/what?":        "/answer",
+		"/docs/*":       "/documentation",
+		"/[":            "/bracket",
+		"foo":           "/bar",
+		"example.com/x": "/y",
+		"/loop/a":       "/loop/b",
+		"/loop/b":       "/loop/a",
+	})
+	testCases := []struct {
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"/what%3F", http.StatusMovedPermanently, "/answer"},
+		{"/whatx", http.StatusNotFound, ""},
+		{"/docs/%2A", http.StatusMovedPermanently, "/documentation"},
+		{"/docs/page", http.StatusNotFound, ""},
+		{"/%5B", http.StatusMovedPermanently, "/bracket"},
+		{"http://foo/", http.StatusNotFound, ""},
+		{"http://example.com/x", http.StatusNotFound, ""},
+		{"/loop/a", http.StatusMovedPermanently, "/loop/b"},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+		if w.Code != tc.wantCode || w.Header().Get("Location") != tc.wantLocation {
+			t.Fatalf("request to %q returned %d to %q, expected %d to %q", tc.path, w.Code, w.Header().Get("Location"), tc.wantCode, tc.wantLocation)
+		}
+	}
+}
+
+func TestServeRedirects(t *testing.T) {
+	s := httptest.NewServer(handy.ServeRedirects(map[string]handy.Redirect{
+		"/default":   {URL: "/new/default"},
+		"/moved":     {URL: "/new/moved", Code: http.StatusMovedPermanently},
+		"/found":     {URL: "/new/found", Code: http.StatusFound},
+		"/see-other": {URL: "/new/see-other", Code: http.StatusSeeOther},
+		"/temporary": {URL: "/new/temporary", Code: http.StatusTemporaryRedirect},
+		"/permanent": {URL: "http://example.com/", Code: http.StatusPermanentRedirect},
+	}, handy.RedirectOptions{Code: http.StatusTemporaryRedirect}))
+	defer s.Close()
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	testCases := []struct {
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"/default", http.StatusTemporaryRedirect, "/new/default"},
+		{"/moved", http.StatusMovedPermanently, "/new/moved"},
+		{"/found", http.StatusFound, "/new/found"},
+		{"/see-other", http.StatusSeeOther, "/new/see-other"},
+		{"/temporary", http.StatusTemporaryRedirect, "/new/temporary"},
+		{"/permanent", http.StatusPermanentRedirect, "http://example.com/"},
+		{"/missing", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.path, func(t *testing.T) {
+			res, err := c.Post(s.URL+tc.path, "text/plain", nil)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("request to %q returned status code %03d, expected %03d", tc.path, res.StatusCode, tc.wantCode)
+			}
+			if res.Header.Get("Location") != tc.wantLocation {
+				t.Fatalf("request to %q returned Location %q, expected %q", tc.path, res.Header.Get("Location"), tc.wantLocation)
+			}
+		})
+	}
+}
+
+func TestServeRedirectsInvalidCode(t *testing.T) {
+	testCases := []struct {
+		name      string
+		redirects map[string]handy.Redirect
+		opts      handy.RedirectOptions
+	}{
+		{"default code", nil, handy.RedirectOptions{Code: http.StatusOK}},
+		{"redirect code", map[string]handy.Redirect{"/foo": {URL: "/bar", Code: http.StatusNotModified}}, handy.RedirectOptions{}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected panic for invalid redirect code")
+				}
+			}()
+			handy.ServeRedirects(tc.redirects, tc.opts)
+		})
+	}
+}
+
+func TestRedirectHandlerUpdates(t *testing.T) {
+	h := handy.ServeRedirects(map[string]handy.Redirect{
+		"/a": {URL: "/one"},
+		"/b": {URL: "/two"},
+	}, handy.RedirectOptions{})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	location := func(path string) string {
+		res, err := c.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("doing request: %+v", err)
+		}
+		res.Body.Close()
+		return res.Header.Get("Location")
+	}
+
+	if err := h.Set("/c", handy.Redirect{URL: "/three"}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	if err := h.Set("/a", handy.Redirect{URL: "/uno"}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	h.Delete("/b")
+	if got, want := location("/a"), "/uno"; got != want {
+		t.Fatalf("request to /a redirected to %q, expected %q", got, want)
+	}
+	if got, want := location("/b"), ""; got != want {
+		t.Fatalf("request to /b redirected to %q, expected %q", got, want)
+	}
+	if got, want := location("/c"), "/three"; got != want {
+		t.Fatalf("request to /c redirected to %q, expected %q", got, want)
+	}
+	wantSnapshot := map[string]handy.Redirect{
+		"/a": {URL: "/uno"},
+		"/c": {URL: "/three"},
+	}
+	if got := h.Snapshot(); !reflect.DeepEqual(got, wantSnapshot) {
+		t.Fatalf("snapshot %+v, expected %+v", got, wantSnapshot)
+	}
+
+	if err := h.Set("/d", handy.Redirect{URL: "/four", Code: http.StatusOK}); err == nil {
+		t.Fatalf("expected error setting invalid redirect")
+	}
+	if err := h.Replace(map[string]handy.Redirect{
+		"/x": {URL: "/ex"},
+		"/y": {URL: "/why", Code: http.StatusTeapot},
+	}); err == nil {
+		t.Fatalf("expected error replacing with invalid redirect")
+	}
+	if got := h.Snapshot(); !reflect.DeepEqual(got, wantSnapshot) {
+		t.Fatalf("snapshot %+v after failed replace, expected %+v", got, wantSnapshot)
+	}
+
+	replacement := map[string]handy.Redirect{"/x": {URL: "/ex"}}
+	if err := h.Replace(replacement); err != nil {
+		t.Fatalf("unexpected error replacing redirects: %+v", err)
+	}
+	replacement["/z"] = handy.Redirect{URL: "/zed"} // must not affect the handler
+	if got, want := location("/a"), ""; got != want {
+		t.Fatalf("request to /a redirected to %q, expected %q", got, want)
+	}
+	if got, want := location("/x"), "/ex"; got != want {
+		t.Fatalf("request to /x redirected to %q, expected %q", got, want)
+	}
+	if got, want := location("/z"), ""; got != want {
+		t.Fatalf("request to /z redirected to %q, expected %q", got, want)
+	}
+}
+
+func TestRedirectHandlerConcurrentUpdates(t *testing.T) {
+	h := handy.ServeRedirects(nil, handy.RedirectOptions{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				from := fmt.Sprintf("/%d/%d", i, j)
+				h.Set(from, handy.Redirect{URL: "/to" + from})
+				if j%3 == 0 {
+					h.Delete(from)
+				}
+				if j%10 == 0 {
+					h.Snapshot()
+				}
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%d/%d", i, j), nil))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got, want := len(h.Snapshot()), 8*66; got != want {
+		t.Fatalf("snapshot has %d redirects, expected %d", got, want)
+	}
+}
+
+func TestServeRedirectsPatterns(t *testing.T) {
+	h := handy.ServeRedirects(map[string]handy.Redirect{
+		"/docs/v1/*":         {URL: "/documentation/*"},
+		"/docs/v1/api/*":     {URL: "https://api.example.com/docs/*", Code: http.StatusFound},
+		"/docs/v1/faq":       {URL: "/help"},
+		"/blog/*":            {URL: "/news"},
+		"/images/*.gif":      {URL: "/images/deprecated"},
+		"/images/[0-9]*.gif": {URL: "/images/numbered"},
+		"/p?ge":              {URL: "/page"},
+	}, handy.RedirectOptions{})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	testCases := []struct {
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"/docs/v1/", http.StatusMovedPermanently, "/documentation/"},
+		{"/docs/v1/intro", http.StatusMovedPermanently, "/documentation/intro"},
+		{"/docs/v1/guide/setup", http.StatusMovedPermanently, "/documentation/guide/setup"},
+		{"/docs/v1/faq", http.StatusMovedPermanently, "/help"},
+		{"/docs/v1/faq/more", http.StatusMovedPermanently, "/documentation/faq/more"},
+		{"/docs/v1/api/users", http.StatusFound, "https://api.example.com/docs/users"},
+		{"/docs/v1", http.StatusNotFound, ""},
+		{"/blog/2016/01/post", http.StatusMovedPermanently, "/news"},
+		{"/images/cat.gif", http.StatusMovedPermanently, "/images/deprecated"},
+		{"/images/1.gif", http.StatusMovedPermanently, "/images/numbered"},
+		{"/images/cats/cat.gif", http.StatusNotFound, ""},
+		{"/page", http.StatusMovedPermanently, "/page"},
+		{"/pages", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.path, func(t *testing.T) {
+			res, err := c.Get(s.URL + tc.path)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("request to %q returned status code %03d, expected %03d", tc.path, res.StatusCode, tc.wantCode)
+			}
+			if res.Header.Get("Location") != tc.wantLocation {
+				t.Fatalf("request to %q returned Location %q, expected %q", tc.path, res.Header.Get("Location"), tc.wantLocation)
+			}
+		})
+	}
+
+	h.Delete("/docs/v1/api/*")
+	if err := h.Set("/blog/*", handy.Redirect{URL: "/news/*"}); err != nil {
+		t.Fatalf("unexpected error setting pattern: %+v", err)
+	}
+	if err := h.Set("/bad/[", handy.Redirect{URL: "/good"}); err == nil {
+		t.Fatalf("expected error setting malformed pattern")
+	}
+	for path, want := range map[string]string{
+		"/docs/v1/api/users": "/documentation/api/users",
+		"/blog/2016/01/post": "/news/2016/01/post",
+	} {
+		res, err := c.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("doing request: %+v", err)
+		}
+		res.Body.Close()
+		if got := res.Header.Get("Location"); got != want {
+			t.Fatalf("request to %q returned Location %q, expected %q", path, got, want)
+		}
+	}
+}
+
+func TestServeRedirectsRegexps(t *testing.T) {
+	h := handy.ServeRedirects(map[string]handy.Redirect{
+		"/user/0/profile": {URL: "/admin"},
+		"/user/1/*":       {URL: "/root/*"},
+	}, handy.RedirectOptions{
+		Regexps: []handy.RegexpRedirect{
+			{Pattern: `^/user/(\d+)/profile$`, Redirect: handy.Redirect{URL: "/profiles/$1"}},
+			{Pattern: `^/user/(?P<id>\d+)/(?P<page>\w+)$`, Redirect: handy.Redirect{URL: "/profiles/${id}?tab=${page}", Code: http.StatusFound}},
+			{Pattern: `^/user/`, Redirect: handy.Redirect{URL: "/profiles"}},
+		},
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	type redirectCase struct {
+		path         string
+		wantCode     int
+		wantLocation string
+	}
+	testRedirects := func(t *testing.T, testCases []redirectCase) {
+		for _, tc := range testCases {
+			res, err := c.Get(s.URL + tc.path)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("request to %q returned status code %03d, expected %03d", tc.path, res.StatusCode, tc.wantCode)
+			}
+			if res.Header.Get("Location") != tc.wantLocation {
+				t.Fatalf("request to %q returned Location %q, expected %q", tc.path, res.Header.Get("Location"), tc.wantLocation)
+			}
+		}
+	}
+
+	testRedirects(t, []redirectCase{
+		{"/user/42/profile", http.StatusMovedPermanently, "/profiles/42"},
+		{"/user/42/settings", http.StatusFound, "/profiles/42?tab=settings"},
+		{"/user/bob", http.StatusMovedPermanently, "/profiles"},
+		{"/user/0/profile", http.StatusMovedPermanently, "/admin"},
+		{"/user/1/profile", http.StatusMovedPermanently, "/root/profile"},
+		{"/users/42/profile", http.StatusNotFound, ""},
+	})
+
+	if err := h.SetRegexps([]handy.RegexpRedirect{
+		{Pattern: `^/user/(\d+)$`, Redirect: handy.Redirect{URL: "/u/$1"}},
+		{Pattern: `^/user/(\d+`, Redirect: handy.Redirect{URL: "/u/$1"}},
+	}); err == nil {
+		t.Fatalf("expected error setting malformed regexp")
+	}
+	if err := h.SetRegexps([]handy.RegexpRedirect{
+		{Pattern: `^/user/(\d+)$`, Redirect: handy.Redirect{URL: "/u/$1", Code: http.StatusOK}},
+	}); err == nil {
+		t.Fatalf("expected error setting invalid redirect code")
+	}
+	if got := len(h.Regexps()); got != 3 {
+		t.Fatalf("have %d regexps after failed updates, expected %d", got, 3)
+	}
+
+	regexps := []handy.RegexpRedirect{{Pattern: `^/user/(\d+)$`, Redirect: handy.Redirect{URL: "/u/$1"}}}
+	if err := h.SetRegexps(regexps); err != nil {
+		t.Fatalf("unexpected error setting regexps: %+v", err)
+	}
+	if got := h.Regexps(); !reflect.DeepEqual(got, regexps) {
+		t.Fatalf("regexps %+v, expected %+v", got, regexps)
+	}
+	testRedirects(t, []redirectCase{
+		{"/user/42", http.StatusMovedPermanently, "/u/42"},
+		{"/user/42/profile", http.StatusNotFound, ""},
+	})
+
+	if _, err := handy.NewRedirectHandler(nil, handy.RedirectOptions{
+		Regexps: []handy.RegexpRedirect{{Pattern: `(`, Redirect: handy.Redirect{URL: "/"}}},
+	}); err == nil {
+		t.Fatalf("expected error constructing handler with malformed regexp")
+	}
+}
+
+func TestServeRedirectsQuery(t *testing.T) {
+	redirects := map[string]handy.Redirect{
+		"/default":       {URL: "/new?ref=old"},
+		"/drop":          {URL: "/new?ref=old", Query: handy.QueryDrop},
+		"/pass":          {URL: "/new?ref=old", Query: handy.QueryPass},
+		"/pass-bare":     {URL: "/new", Query: handy.QueryPass},
+		"/merge":         {URL: "/new?ref=old", Query: handy.QueryMerge},
+		"/override":      {URL: "/new?ref=old", Query: handy.QueryOverride},
+		"/fragment":      {URL: "/new#section", Query: handy.QueryMerge},
+		"/absolute":      {URL: "https://example.com/new?ref=old#top", Query: handy.QueryOverride},
+		"/prefix/*":      {URL: "/new/*", Query: handy.QueryPass},
+		"/prefix-drop/*": {URL: "/new/*"},
+	}
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	testCases := []struct {
+		name         string
+		query        handy.QueryPolicy
+		path         string
+		wantLocation string
+	}{
+		{"default drop", handy.QueryDefault, "/default?utm_source=mail&ref=x", "/new?ref=old"},
+		{"default pass", handy.QueryPass, "/default?utm_source=mail&ref=x", "/new?ref=old&utm_source=mail&ref=x"},
+		{"drop", handy.QueryMerge, "/drop?utm_source=mail", "/new?ref=old"},
+		{"pass", handy.QueryDrop, "/pass?utm_source=mail&ref=x", "/new?ref=old&utm_source=mail&ref=x"},
+		{"pass without destination query", handy.QueryDrop, "/pass-bare?b=2&a=1&b=3", "/new?b=2&a=1&b=3"},
+		{"pass without request query", handy.QueryDrop, "/pass", "/new?ref=old"},
+		{"merge", handy.QueryDrop, "/merge?utm_source=mail&ref=x", "/new?ref=old&utm_source=mail"},
+		{"override", handy.QueryDrop, "/override?utm_source=mail&ref=x", "/new?ref=x&utm_source=mail"},
+		{"fragment", handy.QueryDrop, "/fragment?utm_source=mail", "/new?utm_source=mail#section"},
+		{"absolute", handy.QueryDrop, "/absolute?ref=x", "https://example.com/new?ref=x#top"},
+		{"prefix", handy.QueryDrop, "/prefix/a/b?page=2", "/new/a/b?page=2"},
+		{"prefix default", handy.QueryDrop, "/prefix-drop/a/b?page=2", "/new/a/b"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s := httptest.NewServer(handy.ServeRedirects(redirects, handy.RedirectOptions{Query: tc.query}))
+			defer s.Close()
+			res, err := c.Get(s.URL + tc.path)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.Header.Get("Location") != tc.wantLocation {
+				t.Fatalf("request to %q returned Location %q, expected %q", tc.path, res.Header.Get("Location"), tc.wantLocation)
+			}
+		})
+	}
+}
+
+func TestQueryPolicyText(t *testing.T) {
+	for _, qp := range []handy.QueryPolicy{handy.QueryDefault, handy.QueryDrop, handy.QueryPass, handy.QueryMerge, handy.QueryOverride} {
+		text, err := qp.MarshalText()
+		if err != nil {
+			t.Fatalf("unexpected error marshaling %v: %+v", qp, err)
+		}
+		var got handy.QueryPolicy
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("unexpected error unmarshaling %q: %+v", text, err)
+		}
+		if got != qp {
+			t.Fatalf("unmarshaled %q as %v, expected %v", text, got, qp)
+		}
+	}
+	if _, err := handy.QueryPolicy(42).MarshalText(); err == nil {
+		t.Fatalf("expected error marshaling invalid policy")
+	}
+	var qp handy.QueryPolicy
+	if err := qp.UnmarshalText([]byte("keep")); err == nil {
+		t.Fatalf("expected error unmarshaling unknown policy")
+	}
+	rds, err := handy.ParseRedirects([]byte(`{"/a": {"url": "/b", "query": "merge"}}`), "json")
+	if err != nil {
+		t.Fatalf("unexpected error parsing redirects: %+v", err)
+	}
+	if got, want := rds["/a"], (handy.Redirect{URL: "/b", Query: handy.QueryMerge}); got != want {
+		t.Fatalf("parsed %+v, expected %+v", got, want)
+	}
+}
+
+func TestServeRedirectsHosts(t *testing.T) {
+	h := handy.ServeRedirects(map[string]handy.Redirect{
+		"/pricing":                {URL: "/plans"},
+		"old.example.com/pricing": {URL: "https://example.com/plans"},
+		"*.example.com/login":     {URL: "https://example.com/login"},
+		"*.b.example.com/login":   {URL: "https://b.example.com/login"},
+		"Docs.Example.com/v1/*":   {URL: "https://example.com/docs/*"},
+		"www.example.com":         {URL: "https://example.com/"},
+		"example.org":             {URL: "https://www.example.org", Code: http.StatusPermanentRedirect},
+		"*.example.net":           {URL: "https://example.net", Query: handy.QueryDrop},
+	}, handy.RedirectOptions{})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	testCases := []struct {
+		host         string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"old.example.com", "/pricing", http.StatusMovedPermanently, "https://example.com/plans"},
+		{"OLD.example.com:8080", "/pricing", http.StatusMovedPermanently, "https://example.com/plans"},
+		{"new.example.com", "/pricing", http.StatusMovedPermanently, "/plans"},
+		{"a.example.com", "/login", http.StatusMovedPermanently, "https://example.com/login"},
+		{"a.b.example.com", "/login", http.StatusMovedPermanently, "https://b.example.com/login"},
+		{"example.com", "/login", http.StatusNotFound, ""},
+		{"docs.example.com", "/v1/intro", http.StatusMovedPermanently, "https://example.com/docs/intro"},
+		{"example.com", "/v1/intro", http.StatusNotFound, ""},
+		{"www.example.com", "/about?ref=x", http.StatusMovedPermanently, "https://example.com/about?ref=x"},
+		{"www.example.com", "/pricing", http.StatusMovedPermanently, "/plans"},
+		{"example.org", "/", http.StatusPermanentRedirect, "https://www.example.org/"},
+		{"www.example.org", "/", http.StatusNotFound, ""},
+		{"api.example.net", "/v2/users?page=2", http.StatusMovedPermanently, "https://example.net/v2/users"},
+		{"example.net", "/", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.host+tc.path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, s.URL+tc.path, nil)
+			if err != nil {
+				t.Fatalf("constructing request: %+v", err)
+			}
+			req.Host = tc.host
+			res, err := c.Do(req)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("request to %q returned status code %03d, expected %03d", tc.host+tc.path, res.StatusCode, tc.wantCode)
+			}
+			if res.Header.Get("Location") != tc.wantLocation {
+				t.Fatalf("request to %q returned Location %q, expected %q", tc.host+tc.path, res.Header.Get("Location"), tc.wantLocation)
+			}
+		})
+	}
+
+	if err := h.Set("www.example.com", handy.Redirect{URL: "/home"}); err == nil {
+		t.Fatalf("expected error setting relative host redirect")
+	}
+	h.Delete("DOCS.example.com/v1/*")
+	if _, ok := h.Snapshot()["docs.example.com/v1/*"]; ok {
+		t.Fatalf("expected host redirect to be deleted regardless of case")
+	}
+}
+
+func TestRedirectMiddleware(t *testing.T) {
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("app: " + r.URL.Path))
+	})
+	s := httptest.NewServer(handy.RedirectMiddleware(map[string]handy.Redirect{
+		"/old":   {URL: "/new"},
+		"/old/*": {URL: "/new/*", Code: http.StatusPermanentRedirect},
+	}, app))
+	defer s.Close()
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	testCases := []struct {
+		path         string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"/old", http.StatusMovedPermanently, "/new", ""},
+		{"/old/page", http.StatusPermanentRedirect, "/new/page", ""},
+		{"/new", http.StatusOK, "", "app: /new"},
+		{"/", http.StatusOK, "", "app: /"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.path, func(t *testing.T) {
+			res, err := c.Get(s.URL + tc.path)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("request to %q returned status code %03d, expected %03d", tc.path, res.StatusCode, tc.wantCode)
+			}
+			if res.Header.Get("Location") != tc.wantLocation {
+				t.Fatalf("request to %q returned Location %q, expected %q", tc.path, res.Header.Get("Location"), tc.wantLocation)
+			}
+			if tc.wantBody == "" {
+				return
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("reading response body: %+v", err)
+			}
+			if string(body) != tc.wantBody {
+				t.Fatalf("request to %q returned body %q, expected %q", tc.path, body, tc.wantBody)
+			}
+		})
+	}
+}
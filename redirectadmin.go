@@ -0,0 +1,233 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxAdminBody limits the size of a request to the admin handler.
+const maxAdminBody = 10 << 20
+
+// AdminHandler provides an http.Handler for managing the redirect table,
+// which should be mounted somewhere only trusted clients can reach, using
+// http.StripPrefix as needed.
+//
+//	GET    /rules          export the table as JSON, as read by LoadRedirects
+//	PUT    /rules          replace the table with the JSON in the body
+//	GET    /rules/{path}   get the redirect for /{path} as JSON
+//	PUT    /rules/{path}   add or change the redirect for /{path}
+//	DELETE /rules/{path}   remove the redirect for /{path}
+//
+// A host query parameter limits a rule to a host, so that /rules/old?host=
+// example.com is the rule for example.com/old, and /rules?host=example.com
+// the rule for the whole host.
+//
+// Every response carries an ETag for the rule or table. A PUT or DELETE with
+// an If-Match header is only applied if it still matches, and a PUT with
+// If-None-Match: * only if the rule does not exist, allowing concurrent
+// edits without losing changes. Regular expression redirects are not
+// managed here.
+func (h *RedirectHandler) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.URL.Query().Get("host")
+		switch {
+		case r.URL.Path == "/rules" && host == "":
+			h.serveAdminTable(w, r)
+		case r.URL.Path == "/rules":
+			h.serveAdminRule(w, r, host)
+		case strings.HasPrefix(r.URL.Path, "/rules/"):
+			h.serveAdminRule(w, r, host+strings.TrimPrefix(r.URL.Path, "/rules"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (h *RedirectHandler) serveAdminTable(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.mu.RLock()
+		body, _ := json.Marshal(h.rules.redirects)
+		h.mu.RUnlock()
+		serveAdminJSON(w, r, body)
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAdminBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		redirects, err := ParseRedirects(data, "json")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rules, err := newRedirectRules(redirects, h.norm)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		current, _ := json.Marshal(h.rules.redirects)
+		if !preconditionsMet(r, adminETag(current), true) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if err := h.replace(rules); err != nil {
+			adminError(w, err)
+			return
+		}
+		body, _ := json.Marshal(h.rules.redirects)
+		w.Header().Set("ETag", adminETag(body))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *RedirectHandler) serveAdminRule(w http.ResponseWriter, r *http.Request, from string) {
+	from, err := h.norm.source(from)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.mu.RLock()
+		rd, ok := h.rules.redirects[from]
+		h.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := json.Marshal(rd)
+		serveAdminJSON(w, r, body)
+	case http.MethodPut:
+		var rd Redirect
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBody)).Decode(&rd); err != nil {
+			http.Error(w, "handy: invalid redirect: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateRedirect(from, rd); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		prev, existed := h.rules.redirects[from]
+		if !preconditionsMet(r, ruleETag(prev, existed), existed) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if err := h.set(from, rd); err != nil {
+			adminError(w, err)
+			return
+		}
+		body, _ := json.Marshal(h.rules.redirects[from])
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", adminETag(body))
+		if existed {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		prev, existed := h.rules.redirects[from]
+		if !preconditionsMet(r, ruleETag(prev, existed), existed) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if !existed {
+			http.NotFound(w, r)
+			return
+		}
+		if err := h.delete(from); err != nil {
+			adminError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// adminError responds with err, as a conflict if it is a redirect loop and
+// otherwise as a failure to store the change.
+func adminError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if _, ok := err.(*RedirectLoopError); ok {
+		code = http.StatusConflict
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// serveAdminJSON writes body with its ETag, or just the ETag if the client
+// already has it.
+func serveAdminJSON(w http.ResponseWriter, r *http.Request, body []byte) {
+	etag := adminETag(body)
+	w.Header().Set("ETag", etag)
+	if etagListContains(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// adminETag is the entity tag for a JSON body, derived from its content so
+// that it changes whenever the rule or table does.
+func adminETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// ruleETag is the entity tag for a redirect, or "" if it does not exist.
+func ruleETag(rd Redirect, exists bool) string {
+	if !exists {
+		return ""
+	}
+	body, _ := json.Marshal(rd)
+	return adminETag(body)
+}
+
+// preconditionsMet evaluates the If-Match and If-None-Match headers of a
+// change to a resource with the current etag.
+func preconditionsMet(r *http.Request, etag string, exists bool) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if !exists || (match != "*" && !etagListContains(match, etag)) {
+			return false
+		}
+	}
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && exists {
+		if noneMatch == "*" || etagListContains(noneMatch, etag) {
+			return false
+		}
+	}
+	return true
+}
+
+// etagListContains reports whether the comma separated list of entity tags
+// includes etag.
+func etagListContains(list, etag string) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" && etag != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestRedirectHandlerAdmin(t *testing.T) {
+	h := handy.ServeRedirects(map[string]handy.Redirect{"/old": {URL: "/new"}}, handy.RedirectOptions{})
+	s := httptest.NewServer(http.StripPrefix("/admin", h.AdminHandler()))
+	defer s.Close()
+
+	do := func(method, path, body string, header map[string]string, wantCode int) (*http.Response, string) {
+		var r *http.Request
+		if body != "" {
+			r, _ = http.NewRequest(method, s.URL+path, strings.NewReader(body))
+		} else {
+			r, _ = http.NewRequest(method, s.URL+path, nil)
+		}
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("unexpected error on %s %s: %+v", method, path, err)
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != wantCode {
+			t.Fatalf("%s %s status %d (%s), expected %d", method, path, res.StatusCode, b, wantCode)
+		}
+		return res, string(b)
+	}
+
+	res, body := do("GET", "/admin/rules/old", "", nil, http.StatusOK)
+	if body != `{"url":"/new"}` {
+		t.Fatalf("rule %s, expected /new", body)
+	}
+	etag := res.Header.Get("ETag")
+	do("GET", "/admin/rules/old", "", map[string]string{"If-None-Match": etag}, http.StatusNotModified)
+	do("GET", "/admin/rules/missing", "", nil, http.StatusNotFound)
+
+	res, _ = do("PUT", "/admin/rules/old", `{"url":"/newer","code":302}`, map[string]string{"If-Match": etag}, http.StatusOK)
+	do("PUT", "/admin/rules/old", `{"url":"/newest"}`, map[string]string{"If-Match": etag}, http.StatusPreconditionFailed)
+	do("DELETE", "/admin/rules/old", "", map[string]string{"If-Match": etag}, http.StatusPreconditionFailed)
+	etag = res.Header.Get("ETag")
+
+	do("PUT", "/admin/rules/docs*", `{"url":"/manual*"}`, map[string]string{"If-None-Match": "*"}, http.StatusCreated)
+	do("PUT", "/admin/rules/docs*", `{"url":"/other*"}`, map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed)
+	do("PUT", "/admin/rules/pricing?host=Old.Example.com", `{"url":"https://example.com/plans"}`, nil, http.StatusCreated)
+	do("PUT", "/admin/rules?host=www.example.com", `{"url":"https://example.com"}`, nil, http.StatusCreated)
+	do("PUT", "/admin/rules/bad", `{"url":"/x","code":200}`, nil, http.StatusBadRequest)
+	do("PUT", "/admin/rules/bad", `not json`, nil, http.StatusBadRequest)
+	do("PUT", "/admin/rules/newer", `{"url":"/old"}`, nil, http.StatusConflict)
+	do("PATCH", "/admin/rules/old", "", nil, http.StatusMethodNotAllowed)
+	do("GET", "/admin/other", "", nil, http.StatusNotFound)
+
+	want := map[string]handy.Redirect{
+		"/old":                    {URL: "/newer", Code: 302},
+		"/docs*":                  {URL: "/manual*"},
+		"old.example.com/pricing": {URL: "https://example.com/plans"},
+		"www.example.com":         {URL: "https://example.com"},
+	}
+	if got := h.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("redirects %+v, expected %+v", got, want)
+	}
+
+	res, body = do("GET", "/admin/rules", "", nil, http.StatusOK)
+	exported, err := handy.ParseRedirects([]byte(body), "json")
+	if err != nil || !reflect.DeepEqual(exported, want) {
+		t.Fatalf("exported %s (%v), expected %+v", body, err, want)
+	}
+	tableTag := res.Header.Get("ETag")
+
+	do("DELETE", "/admin/rules/old", "", map[string]string{"If-Match": etag}, http.StatusNoContent)
+	do("DELETE", "/admin/rules/old", "", nil, http.StatusNotFound)
+
+	do("PUT", "/admin/rules", `{"/a": "/b"}`, map[string]string{"If-Match": tableTag}, http.StatusPreconditionFailed)
+	do("PUT", "/admin/rules", `{"/a": "/b", "/b": "/a"}`, nil, http.StatusConflict)
+	do("PUT", "/admin/rules", `{"/a": `, nil, http.StatusBadRequest)
+	res, _ = do("GET", "/admin/rules", "", nil, http.StatusOK)
+	res, _ = do("PUT", "/admin/rules", `{"/a": "/b", "/c": {"url": "/d", "code": 307}}`, map[string]string{"If-Match": res.Header.Get("ETag")}, http.StatusNoContent)
+	do("GET", "/admin/rules", "", map[string]string{"If-None-Match": res.Header.Get("ETag")}, http.StatusNotModified)
+	want = map[string]handy.Redirect{"/a": {URL: "/b"}, "/c": {URL: "/d", Code: 307}}
+	if got := h.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("redirects %+v after import, expected %+v", got, want)
+	}
+}
@@ -0,0 +1,385 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoadRedirects reads a redirect table from the named file, choosing the
+// format from the file extension as described by ParseRedirects.
+func LoadRedirects(filename string) (map[string]Redirect, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	redirects, err := ParseRedirects(data, strings.TrimPrefix(filepath.Ext(filename), "."))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return redirects, nil
+}
+
+// ParseRedirects parses a redirect table in one of the following formats:
+//
+//	csv       rows of from,to[,code], with an optional from,to,code header
+//	json      an object of "from": "to" or "from": {"url": "to", "code": 308}
+//	yaml, yml a mapping of from: to, or from: with a nested url: and
+//	          optional code:, not_before:, and not_after: (RFC 3339 times)
+//	conf      Apache Redirect directives or nginx exact location returns
+//	htaccess  Apache Redirect directives
+//
+// Only the subsets of YAML, Apache, and nginx syntax above are supported.
+func ParseRedirects(data []byte, format string) (map[string]Redirect, error) {
+	var (
+		redirects map[string]Redirect
+		err       error
+	)
+	switch strings.ToLower(format) {
+	case "csv":
+		redirects, err = parseRedirectsCSV(data)
+	case "json":
+		redirects, err = parseRedirectsJSON(data)
+	case "yaml", "yml":
+		redirects, err = parseRedirectsYAML(data)
+	case "conf", "htaccess":
+		redirects, err = parseRedirectsConf(data)
+	default:
+		return nil, fmt.Errorf("handy: unknown redirect format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for from, to := range redirects {
+		if err := validateRedirect(from, to); err != nil {
+			return nil, err
+		}
+	}
+	return redirects, nil
+}
+
+func parseRedirectsCSV(data []byte) (map[string]Redirect, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	redirects := make(map[string]Redirect)
+	for n := 1; ; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return redirects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 1 && strings.EqualFold(record[0], "from") {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("record %d: expected from,to[,code], found %d fields", n, len(record))
+		}
+		rd := Redirect{URL: record[1]}
+		if len(record) == 3 && record[2] != "" {
+			if rd.Code, err = strconv.Atoi(record[2]); err != nil {
+				return nil, fmt.Errorf("record %d: invalid code %q", n, record[2])
+			}
+		}
+		if err := addRedirect(redirects, record[0], rd); err != nil {
+			return nil, fmt.Errorf("record %d: %v", n, err)
+		}
+	}
+}
+
+func parseRedirectsJSON(data []byte) (map[string]Redirect, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	redirects := make(map[string]Redirect, len(raw))
+	for from, msg := range raw {
+		var rd Redirect
+		if err := json.Unmarshal(msg, &rd.URL); err != nil {
+			if err := json.Unmarshal(msg, &rd); err != nil {
+				return nil, fmt.Errorf("redirect for %q: %v", from, err)
+			}
+			if rd.URL == "" {
+				return nil, fmt.Errorf("missing url for %q", from)
+			}
+		}
+		redirects[from] = rd
+	}
+	return redirects, nil
+}
+
+func parseRedirectsYAML(data []byte) (map[string]Redirect, error) {
+	redirects := make(map[string]Redirect)
+	var (
+		from   string
+		nested int // the line starting the block of fields for from, if any
+	)
+	// endBlock checks the block of fields just read gave the redirect a url.
+	endBlock := func() error {
+		if nested > 0 && redirects[from].URL == "" {
+			return fmt.Errorf("line %d: missing url for %q", nested, from)
+		}
+		return nil
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := stripYAMLComment(s.Text())
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+		indented := text[0] == ' ' || text[0] == '\t'
+		key, value, ok := splitYAMLPair(text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", line)
+		}
+		if indented {
+			if nested == 0 {
+				return nil, fmt.Errorf("line %d: unexpected indentation", line)
+			}
+			rd := redirects[from]
+			switch key {
+			case "url":
+				rd.URL = value
+			case "code":
+				code, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid code %q", line, value)
+				}
+				rd.Code = code
+			case "not_before", "not_after":
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid time %q", line, value)
+				}
+				if key == "not_before" {
+					rd.NotBefore = t
+				} else {
+					rd.NotAfter = t
+				}
+			default:
+				return nil, fmt.Errorf("line %d: unknown field %q", line, key)
+			}
+			redirects[from] = rd
+			continue
+		}
+		if err := endBlock(); err != nil {
+			return nil, err
+		}
+		from, nested = key, 0
+		if value == "" {
+			nested = line
+		}
+		if err := addRedirect(redirects, from, Redirect{URL: value}); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := endBlock(); err != nil {
+		return nil, err
+	}
+	return redirects, nil
+}
+
+// stripYAMLComment removes a trailing comment, ignoring # within quotes.
+func stripYAMLComment(text string) string {
+	var quote rune
+	for i, c := range text {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimRight(text[:i], " \t")
+		}
+	}
+	return strings.TrimRight(text, " \t")
+}
+
+// splitYAMLPair splits a key: value line, unquoting either side.
+func splitYAMLPair(text string) (key, value string, ok bool) {
+	text = strings.TrimSpace(text)
+	var i int
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		i = end + 2
+		if !strings.HasPrefix(text[i:], ":") {
+			return "", "", false
+		}
+	} else if i = strings.Index(text, ": "); i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		i = len(text) - 1
+	}
+	return unquoteYAML(text[:i]), unquoteYAML(text[i+1:]), true
+}
+
+func unquoteYAML(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// apacheCodes maps the named statuses of the Apache Redirect directive.
+var apacheCodes = map[string]int{
+	"permanent": http.StatusMovedPermanently,
+	"temp":      http.StatusFound,
+	"seeother":  http.StatusSeeOther,
+}
+
+func parseRedirectsConf(data []byte) (map[string]Redirect, error) {
+	redirects := make(map[string]Redirect)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		from, rd, err := parseConfDirective(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := addRedirect(redirects, from, rd); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return redirects, s.Err()
+}
+
+// parseConfDirective parses one of
+//
+//	Redirect [status] from to
+//	RedirectPermanent from to
+//	RedirectTemp from to
+//	location = from { return code to; }
+func parseConfDirective(fields []string) (string, Redirect, error) {
+	switch strings.ToLower(fields[0]) {
+	case "redirect":
+		switch len(fields) {
+		case 3:
+			if _, err := strconv.Atoi(fields[1]); err == nil || apacheCodes[strings.ToLower(fields[1])] != 0 {
+				return "", Redirect{}, fmt.Errorf("missing target for Redirect %s %s", fields[1], fields[2])
+			}
+			return fields[1], Redirect{URL: fields[2], Code: apacheCodes["temp"]}, nil
+		case 4:
+			code, ok := apacheCodes[strings.ToLower(fields[1])]
+			if !ok {
+				var err error
+				if code, err = strconv.Atoi(fields[1]); err != nil {
+					return "", Redirect{}, fmt.Errorf("unsupported Redirect status %q", fields[1])
+				}
+			}
+			return fields[2], Redirect{URL: fields[3], Code: code}, nil
+		}
+	case "redirectpermanent":
+		if len(fields) == 3 {
+			return fields[1], Redirect{URL: fields[2], Code: apacheCodes["permanent"]}, nil
+		}
+	case "redirecttemp":
+		if len(fields) == 3 {
+			return fields[1], Redirect{URL: fields[2], Code: apacheCodes["temp"]}, nil
+		}
+	case "location":
+		if len(fields) == 8 && fields[1] == "=" && fields[3] == "{" &&
+			fields[4] == "return" && strings.HasSuffix(fields[6], ";") && fields[7] == "}" {
+			code, err := strconv.Atoi(fields[5])
+			if err != nil {
+				return "", Redirect{}, fmt.Errorf("invalid return code %q", fields[5])
+			}
+			return fields[2], Redirect{URL: strings.TrimSuffix(fields[6], ";"), Code: code}, nil
+		}
+	default:
+		return "", Redirect{}, fmt.Errorf("unsupported directive %q", fields[0])
+	}
+	return "", Redirect{}, fmt.Errorf("malformed %s directive", fields[0])
+}
+
+func addRedirect(redirects map[string]Redirect, from string, rd Redirect) error {
+	if from == "" {
+		return fmt.Errorf("missing redirect source")
+	}
+	if _, ok := redirects[from]; ok {
+		return fmt.Errorf("duplicate redirect for %q", from)
+	}
+	redirects[from] = rd
+	return nil
+}
+
+// WatchFile loads the redirect table from the named file, as LoadRedirects
+// does, and then checks the file for changes every interval, swapping in the
+// new table whenever it changes. If a changed file cannot be loaded, the
+// error is passed to onError, if set, and the current table is kept. Call
+// the returned function to stop watching; once it returns, the table will
+// not be reloaded again.
+func (h *RedirectHandler) WatchFile(filename string, interval time.Duration, onError func(error)) (stop func(), err error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	redirects, err := LoadRedirects(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Replace(redirects); err != nil {
+		return nil, err
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			latest, err := os.Stat(filename)
+			if err == nil && latest.ModTime().Equal(fi.ModTime()) && latest.Size() == fi.Size() {
+				continue
+			}
+			if err == nil {
+				fi = latest
+				var redirects map[string]Redirect
+				if redirects, err = LoadRedirects(filename); err == nil {
+					err = h.Replace(redirects)
+				}
+			}
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}, nil
+}
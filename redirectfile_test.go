@@ -0,0 +1,231 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestParseRedirects(t *testing.T) {
+	want := map[string]handy.Redirect{
+		"/old":     {URL: "/new"},
+		"/api/v1":  {URL: "https://api.example.com/v2", Code: 308},
+		"/pricing": {URL: "/plans", Code: 302},
+	}
+
+	testCases := []struct {
+		name   string
+		format string
+		data   string
+		want   map[string]handy.Redirect
+	}{
+		{"csv",
+			"csv",
+			`from,to,code
+# comment
+/old,/new
+/api/v1,https://api.example.com/v2,308
+"/pricing", /plans, 302
+`,
+			want,
+		},
+		{"csv without header",
+			"CSV",
+			"/old,/new,\n",
+			map[string]handy.Redirect{"/old": {URL: "/new"}},
+		},
+		{"json",
+			"json",
+			`{
+	"/old": "/new",
+	"/api/v1": {"url": "https://api.example.com/v2", "code": 308},
+	"/pricing": {"url": "/plans", "code": 302}
+}`,
+			want,
+		},
+		{"yaml",
+			"yaml",
+			`---
+# comment
+/old: /new
+"/api/v1":
+  url: "https://api.example.com/v2"
+  code: 308
+'/pricing': # trailing comment
+  url: /plans
+  code: 302
+`,
+			want,
+		},
+		{"yml",
+			"yml",
+			"/old: /new # comment\n",
+			map[string]handy.Redirect{"/old": {URL: "/new"}},
+		},
+		{"apache",
+			"htaccess",
+			`# comment
+Redirect /old /new
+Redirect 308 /api/v1 https://api.example.com/v2
+Redirect temp /pricing /plans
+RedirectPermanent /a /b
+RedirectTemp /c /d
+Redirect seeother /e /f
+`,
+			map[string]handy.Redirect{
+				"/old":     {URL: "/new", Code: 302},
+				"/api/v1":  {URL: "https://api.example.com/v2", Code: 308},
+				"/pricing": {URL: "/plans", Code: 302},
+				"/a":       {URL: "/b", Code: 301},
+				"/c":       {URL: "/d", Code: 302},
+				"/e":       {URL: "/f", Code: 303},
+			},
+		},
+		{"nginx",
+			"conf",
+			`location = /old { return 301 /new; }
+location = /api/v1 { return 308 https://api.example.com/v2; }
+Redirect /pricing /plans
+`,
+			map[string]handy.Redirect{
+				"/old":     {URL: "/new", Code: 301},
+				"/api/v1":  {URL: "https://api.example.com/v2", Code: 308},
+				"/pricing": {URL: "/plans", Code: 302},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := handy.ParseRedirects([]byte(tc.data), tc.format)
+			if err != nil {
+				t.Fatalf("unexpected error parsing redirects: %+v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("parsed %+v, expected %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRedirectsErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+		data   string
+	}{
+		{"unknown format", "txt", "/old /new"},
+		{"csv too few fields", "csv", "/old\n"},
+		{"csv too many fields", "csv", "/old,/new,301,extra\n"},
+		{"csv bad code", "csv", "/old,/new,permanent\n"},
+		{"csv invalid code", "csv", "/old,/new,200\n"},
+		{"csv duplicate", "csv", "/old,/new\n/old,/newer\n"},
+		{"json malformed", "json", `{"/old": `},
+		{"json wrong type", "json", `{"/old": 301}`},
+		{"json invalid code", "json", `{"/old": {"url": "/new", "code": 404}}`},
+		{"json no url", "json", `{"/old": {"code": 301}}`},
+		{"yaml no value", "yaml", "/old /new\n"},
+		{"yaml bad indentation", "yaml", "/old: /new\n  code: 301\n"},
+		{"yaml unknown field", "yaml", "/old:\n  to: /new\n"},
+		{"yaml bad code", "yaml", "/old:\n  url: /new\n  code: soon\n"},
+		{"yaml duplicate", "yaml", "/old: /new\n/old: /newer\n"},
+		{"yaml no url", "yaml", "/old:\n"},
+		{"yaml block without url", "yaml", "/old:\n  code: 301\n/other: /new\n"},
+		{"conf unknown directive", "conf", "RewriteRule ^/old$ /new [R=301]\n"},
+		{"conf malformed redirect", "conf", "Redirect /old\n"},
+		{"conf missing target", "conf", "Redirect 301 /old\n"},
+		{"conf missing target after keyword", "conf", "Redirect permanent /old\n"},
+		{"conf unsupported status", "conf", "Redirect gone /old /new\n"},
+		{"conf malformed location", "conf", "location /old { return 301 /new; }\n"},
+		{"conf invalid code", "conf", "location = /old { return 200 /new; }\n"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := handy.ParseRedirects([]byte(tc.data), tc.format); err == nil {
+				t.Fatalf("parsed %+v, expected error", got)
+			}
+		})
+	}
+}
+
+func TestRedirectHandlerWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handy")
+	if err != nil {
+		t.Fatalf("creating temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "redirects.json")
+	modTime := time.Now()
+	writeFile := func(data string) {
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatalf("writing redirects: %+v", err)
+		}
+		modTime = modTime.Add(time.Second) // ensure every write is noticed
+		if err := os.Chtimes(filename, modTime, modTime); err != nil {
+			t.Fatalf("changing modification time: %+v", err)
+		}
+	}
+	waitFor := func(want map[string]handy.Redirect, h *handy.RedirectHandler) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !reflect.DeepEqual(h.Snapshot(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("redirects %+v, expected %+v", h.Snapshot(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	h := handy.ServeRedirects(nil, handy.RedirectOptions{})
+	if _, err := h.WatchFile(filename, time.Millisecond, nil); err == nil {
+		t.Fatalf("expected error watching missing file")
+	}
+
+	writeFile(`{"/a": "/one"}`)
+	errs := make(chan error, 1)
+	stop, err := h.WatchFile(filename, time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error watching file: %+v", err)
+	}
+	defer stop()
+	waitFor(map[string]handy.Redirect{"/a": {URL: "/one"}}, h)
+
+	writeFile(`{"/a": "/uno", "/b": {"url": "/two", "code": 307}}`)
+	want := map[string]handy.Redirect{"/a": {URL: "/uno"}, "/b": {URL: "/two", Code: 307}}
+	waitFor(want, h)
+
+	writeFile(`{"/a": {"url": "/bad", "code": 200}}`)
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected error loading invalid redirects")
+	}
+	if got := h.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("redirects %+v after invalid reload, expected %+v", got, want)
+	}
+
+	writeFile(`{"/c": "/three"}`)
+	waitFor(map[string]handy.Redirect{"/c": {URL: "/three"}}, h)
+
+	stop()
+	writeFile(`{"/d": "/four"}`)
+	time.Sleep(20 * time.Millisecond)
+	if got, want := h.Snapshot(), map[string]handy.Redirect{"/c": {URL: "/three"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("redirects %+v after stop, expected %+v", got, want)
+	}
+}
@@ -0,0 +1,431 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// radixNode is a node of a radix tree, holding the values for the key made
+// up of the labels on the way to it.
+type radixNode struct {
+	label    string
+	indices  string // the first byte of the label of each child, in order
+	children []*radixNode
+	values   []interface{}
+}
+
+// child returns the index of the child whose label starts with b, or where
+// it would be inserted.
+func (n *radixNode) child(b byte) (int, bool) {
+	i := 0
+	for i < len(n.indices) && n.indices[i] < b {
+		i++
+	}
+	return i, i < len(n.indices) && n.indices[i] == b
+}
+
+// insert adds v to the values for key.
+func (n *radixNode) insert(key string, v interface{}) {
+	for key != "" {
+		i, ok := n.child(key[0])
+		if !ok {
+			n.indices = n.indices[:i] + key[:1] + n.indices[i:]
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = &radixNode{label: key, values: []interface{}{v}}
+			return
+		}
+		c := n.children[i]
+		l := 1
+		for l < len(c.label) && l < len(key) && c.label[l] == key[l] {
+			l++
+		}
+		if l < len(c.label) {
+			split := &radixNode{label: c.label[:l], indices: c.label[l : l+1], children: []*radixNode{c}}
+			c.label = c.label[l:]
+			n.children[i] = split
+			c = split
+		}
+		n, key = c, key[l:]
+	}
+	n.values = append(n.values, v)
+}
+
+// remove drops the values for key for which drop returns true, pruning
+// nodes left empty.
+func (n *radixNode) remove(key string, drop func(interface{}) bool) {
+	if key == "" {
+		kept := n.values[:0]
+		for _, v := range n.values {
+			if !drop(v) {
+				kept = append(kept, v)
+			}
+		}
+		n.values = kept
+		return
+	}
+	i, ok := n.child(key[0])
+	if !ok || !strings.HasPrefix(key, n.children[i].label) {
+		return
+	}
+	c := n.children[i]
+	c.remove(key[len(c.label):], drop)
+	switch {
+	case len(c.values) > 0:
+	case len(c.children) == 0:
+		n.indices = n.indices[:i] + n.indices[i+1:]
+		n.children = append(n.children[:i], n.children[i+1:]...)
+	case len(c.children) == 1:
+		gc := c.children[0]
+		gc.label = c.label + gc.label
+		n.children[i] = gc
+	}
+}
+
+// next returns the child whose label starts key, along with the rest of
+// key, or nil if there is none. Following next from the root visits the
+// nodes for every prefix of key, from shortest to longest.
+func (n *radixNode) next(key string) (*radixNode, string) {
+	if key == "" {
+		return nil, ""
+	}
+	i, ok := n.child(key[0])
+	if !ok {
+		return nil, ""
+	}
+	c := n.children[i]
+	// the first byte is known to match, so short labels need no comparison
+	if len(c.label) > 1 && !strings.HasPrefix(key, c.label) {
+		return nil, ""
+	}
+	return c, key[len(c.label):]
+}
+
+// prefixTree holds values by key, to find those for every key that is a
+// prefix of some text. Keys are split at each slash: every node has its
+// children by the next segment, up to and including its slash, and a radix
+// tree for the keys that end within the segment. At hundreds of thousands
+// of keys, walking a single tree through the whole of a path is slow for
+// want of cache, whereas this takes a lookup for each slash in the path and
+// only walks a tree through the last segment. The nodes near the root are
+// shared by many keys, so they usually stay in cache, and have few enough
+// children that they are searched without hashing.
+type prefixTree struct {
+	rest  radixNode
+	dirs  map[string]*prefixTree // the children, once there are many
+	edges []prefixEdge           // the children, while there are few
+}
+
+// prefixEdge is a child of a prefixTree, and the segment that leads to it.
+type prefixEdge struct {
+	segment string
+	child   *prefixTree
+}
+
+// maxPrefixEdges is the number of children a prefixTree searches in turn
+// before it puts them in a map.
+const maxPrefixEdges = 8
+
+// cutSegment splits key after its first slash, if it has one. Segments are
+// short enough that a loop is quicker than strings.IndexByte.
+func cutSegment(key string) (segment, rest string, ok bool) {
+	for i := 0; i < len(key); i++ {
+		if key[i] == '/' {
+			return key[:i+1], key[i+1:], true
+		}
+	}
+	return "", key, false
+}
+
+// child returns the child for segment, or nil if there is none.
+func (t *prefixTree) child(segment string) *prefixTree {
+	if t.dirs != nil {
+		return t.dirs[segment]
+	}
+	for _, e := range t.edges {
+		if e.segment == segment {
+			return e.child
+		}
+	}
+	return nil
+}
+
+// addChild adds an empty child for segment.
+func (t *prefixTree) addChild(segment string) *prefixTree {
+	c := &prefixTree{}
+	if t.dirs == nil && len(t.edges) < maxPrefixEdges {
+		t.edges = append(t.edges, prefixEdge{segment: segment, child: c})
+		return c
+	}
+	if t.dirs == nil {
+		t.dirs = make(map[string]*prefixTree)
+		for _, e := range t.edges {
+			t.dirs[e.segment] = e.child
+		}
+		t.edges = nil
+	}
+	t.dirs[segment] = c
+	return c
+}
+
+// removeChild removes the child for segment.
+func (t *prefixTree) removeChild(segment string) {
+	if t.dirs != nil {
+		delete(t.dirs, segment)
+		return
+	}
+	for i, e := range t.edges {
+		if e.segment == segment {
+			t.edges = append(t.edges[:i], t.edges[i+1:]...)
+			return
+		}
+	}
+}
+
+// empty reports whether t holds no values.
+func (t *prefixTree) empty() bool {
+	return len(t.edges) == 0 && len(t.dirs) == 0 && len(t.rest.values) == 0 && len(t.rest.children) == 0
+}
+
+// insert adds v to the values for key.
+func (t *prefixTree) insert(key string, v interface{}) {
+	for {
+		segment, rest, ok := cutSegment(key)
+		if !ok {
+			t.rest.insert(key, v)
+			return
+		}
+		c := t.child(segment)
+		if c == nil {
+			c = t.addChild(segment)
+		}
+		t, key = c, rest
+	}
+}
+
+// remove drops the values for key for which drop returns true, pruning
+// nodes left empty.
+func (t *prefixTree) remove(key string, drop func(interface{}) bool) {
+	segment, rest, ok := cutSegment(key)
+	if !ok {
+		t.rest.remove(key, drop)
+		return
+	}
+	c := t.child(segment)
+	if c == nil {
+		return
+	}
+	c.remove(rest, drop)
+	if c.empty() {
+		t.removeChild(segment)
+	}
+}
+
+// visit calls f with the values for each key that is a prefix of text, from
+// the shortest key to the longest.
+func (t *prefixTree) visit(text string, f func(values []interface{})) {
+	for t != nil {
+		// no label holds a slash, so the walk ends within the segment
+		for n, key := &t.rest, text; n != nil; n, key = n.next(key) {
+			if len(n.values) > 0 {
+				f(n.values)
+			}
+		}
+		segment, rest, ok := cutSegment(text)
+		if !ok {
+			return
+		}
+		t, text = t.child(segment), rest
+	}
+}
+
+// patternIndex holds the patterns of a redirect table, with prefix rules in
+// a prefixTree so that matching takes time in proportion to the length of
+// the path rather than the number of rules.
+type patternIndex struct {
+	prefixes *prefixTree
+	globs    []redirectPattern // ordered by patternLess
+}
+
+func newPatternIndex() patternIndex {
+	return patternIndex{prefixes: &prefixTree{}}
+}
+
+// patternLess orders patterns from most to least specific: patterns for a
+// host first, then the longest path, then the longest host.
+func patternLess(a, b redirectPattern) bool {
+	switch {
+	case (a.host == "") != (b.host == ""):
+		return a.host != ""
+	case len(a.path) != len(b.path):
+		return len(a.path) > len(b.path)
+	case len(a.host) != len(b.host):
+		return len(a.host) > len(b.host)
+	}
+	return a.from < b.from
+}
+
+func (idx *patternIndex) add(p redirectPattern) {
+	if !p.glob {
+		idx.prefixes.insert(p.prefix, p)
+		return
+	}
+	i := sort.Search(len(idx.globs), func(i int) bool { return !patternLess(idx.globs[i], p) })
+	idx.globs = append(idx.globs, redirectPattern{})
+	copy(idx.globs[i+1:], idx.globs[i:])
+	idx.globs[i] = p
+}
+
+// remove drops the pattern for the source from, if any.
+func (idx *patternIndex) remove(from string) {
+	p, _ := newRedirectPattern(from, Redirect{})
+	if !p.glob {
+		idx.prefixes.remove(p.prefix, func(v interface{}) bool { return v.(redirectPattern).from == from })
+		return
+	}
+	kept := idx.globs[:0]
+	for _, g := range idx.globs {
+		if g.from != from {
+			kept = append(kept, g)
+		}
+	}
+	idx.globs = kept
+}
+
+// match finds the most specific pattern active at now that matches host and
+// urlPath.
+func (idx *patternIndex) match(host, urlPath string, now time.Time) (redirectPattern, bool) {
+	var (
+		best  redirectPattern
+		found bool
+	)
+	idx.prefixes.visit(urlPath, func(values []interface{}) {
+		for _, v := range values {
+			p := v.(redirectPattern)
+			if (p.host == "" || matchHost(p.host, host)) && p.rd.activeAt(now) && (!found || patternLess(p, best)) {
+				best, found = p, true
+			}
+		}
+	})
+	for _, g := range idx.globs {
+		if found && patternLess(best, g) {
+			break // no later glob is more specific
+		}
+		if _, ok := g.match(host, urlPath, urlPath); ok && g.rd.activeAt(now) {
+			return g, true
+		}
+	}
+	return best, found
+}
+
+// regexpSet holds regular expression redirects, indexing those anchored to
+// the start of the path by their literal prefix so that only those that
+// might match a path are tried, each by the regexp for the rest of it. The
+// index and the shared regexps act as a single compiled matcher for the
+// common case of many regexps that differ in their prefixes. Regexps that
+// are not anchored, or start with no literal text, are each tried in turn
+// for every path that reaches them.
+type regexpSet struct {
+	list       []regexpRedirect
+	anchored   *prefixTree // of the regexps in list, by literal prefix
+	unanchored []*regexpRedirect
+	scheduled  int // regexps limited to some time
+}
+
+func newRegexpSet(list []regexpRedirect) regexpSet {
+	set := regexpSet{list: list, anchored: &prefixTree{}}
+	for i := range list {
+		rr := &list[i]
+		rr.order = i
+		if rr.scheduled() {
+			set.scheduled++
+		}
+		if rr.anchored {
+			set.anchored.insert(rr.prefix, rr)
+		} else {
+			set.unanchored = append(set.unanchored, rr)
+		}
+	}
+	return set
+}
+
+// match returns the first regexp in order, active at now, that matches
+// urlPath, and its expanded destination.
+func (set regexpSet) match(urlPath string, now time.Time) (*regexpRedirect, string, bool) {
+	var buf [16]*regexpRedirect
+	candidates := append(buf[:0], set.unanchored...)
+	set.anchored.visit(urlPath, func(values []interface{}) {
+		for _, v := range values {
+			// insertion keeps the few candidates in order without the
+			// allocation sort.Slice would make
+			i := len(candidates)
+			candidates = append(candidates, v.(*regexpRedirect))
+			for ; i > 0 && candidates[i-1].order > candidates[i].order; i-- {
+				candidates[i-1], candidates[i] = candidates[i], candidates[i-1]
+			}
+		}
+	})
+	for _, rr := range candidates {
+		if !rr.activeAt(now) {
+			continue
+		}
+		if dest, ok := rr.match(urlPath); ok {
+			return rr, dest, true
+		}
+	}
+	return nil, "", false
+}
+
+// anchoredPrefix returns the literal text any match of pattern must start
+// with, if it can only match at the start of the text. If the rest of the
+// pattern can be matched on its own after the prefix, it is returned as a
+// pattern anchored to the start of the text; it cannot if it looks at the
+// text before it, as ^ in multi-line mode and \b do.
+func anchoredPrefix(pattern string) (prefix, rest string, ok bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", "", false
+	}
+	re = re.Simplify()
+	if re.Op == syntax.OpBeginText {
+		return "", "", true
+	}
+	if re.Op != syntax.OpConcat || re.Sub[0].Op != syntax.OpBeginText {
+		return "", "", false
+	}
+	var b []byte
+	subs := re.Sub[1:]
+	for len(subs) > 0 && subs[0].Op == syntax.OpLiteral && subs[0].Flags&syntax.FoldCase == 0 {
+		for _, r := range subs[0].Rune {
+			var enc [utf8.UTFMax]byte
+			b = append(b, enc[:utf8.EncodeRune(enc[:], r)]...)
+		}
+		subs = subs[1:]
+	}
+	if len(b) == 0 || looksBehind(subs) {
+		return string(b), "", true
+	}
+	rest = (&syntax.Regexp{Op: syntax.OpConcat, Sub: append([]*syntax.Regexp{re.Sub[0]}, subs...)}).String()
+	return string(b), rest, true
+}
+
+// looksBehind reports whether any of res depends on the text before where
+// it is matched.
+func looksBehind(res []*syntax.Regexp) bool {
+	for _, re := range res {
+		switch re.Op {
+		case syntax.OpBeginLine, syntax.OpBeginText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+			return true
+		}
+		if looksBehind(re.Sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestServeRedirectsPrefixIndex(t *testing.T) {
+	// prefixes sharing parts of their paths, changed one at a time, must
+	// still match as the longest prefix would, with enough segments that
+	// some nodes have too many children to list
+	segments := []string{"a", "ab", "abc", "b", "ba", "c", "d", "e", "f", "g"}
+	var prefixes []string
+	for _, s1 := range segments {
+		prefixes = append(prefixes, "/"+s1)
+		for _, s2 := range segments {
+			prefixes = append(prefixes, "/"+s1+"/"+s2, "/"+s1+"/"+s2+"/")
+		}
+	}
+	rnd := rand.New(rand.NewSource(1))
+	h := handy.ServeRedirects(nil, handy.RedirectOptions{})
+	active := make(map[string]bool)
+	for i := 0; i < 2000; i++ {
+		prefix := prefixes[rnd.Intn(len(prefixes))]
+		if active[prefix] {
+			h.Delete(prefix + "*")
+			delete(active, prefix)
+		} else {
+			if err := h.Set(prefix+"*", handy.Redirect{URL: "https://example.com" + prefix}); err != nil {
+				t.Fatalf("unexpected error setting redirect: %+v", err)
+			}
+			active[prefix] = true
+		}
+
+		for _, path := range []string{"/a", "/ab/abc/x", "/abc/b/", "/b/ba", "/ba/a/", "/c", "/g/f/", "/h"} {
+			var want string
+			for prefix := range active {
+				if strings.HasPrefix(path, prefix) && len(prefix) > len(want) {
+					want = prefix
+				}
+			}
+			if want != "" {
+				want = "https://example.com" + want
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			if got := w.Header().Get("Location"); got != want {
+				t.Fatalf("step %d: request for %q redirected to %q, expected %q", i, path, got, want)
+			}
+		}
+	}
+}
+
+func TestServeRedirectsRegexpOrder(t *testing.T) {
+	h := handy.ServeRedirects(nil, handy.RedirectOptions{
+		Regexps: []handy.RegexpRedirect{
+			{Pattern: `^/a/b/`, Redirect: handy.Redirect{URL: "/first"}},
+			{Pattern: `x$`, Redirect: handy.Redirect{URL: "/second"}},
+			{Pattern: `^/a/`, Redirect: handy.Redirect{URL: "/third"}},
+			{Pattern: `^/(a|b)/`, Redirect: handy.Redirect{URL: "/fourth"}},
+			{Pattern: `(?i)^/C/`, Redirect: handy.Redirect{URL: "/fifth"}},
+			{Pattern: `^`, Redirect: handy.Redirect{URL: "/last"}},
+		},
+	})
+
+	testCases := []struct {
+		path string
+		want string
+	}{
+		{"/a/b/c", "/first"},
+		{"/a/b/x", "/first"},
+		{"/a/x", "/second"},
+		{"/a/c", "/third"},
+		{"/b/c", "/fourth"},
+		{"/c/d", "/fifth"},
+		{"/d", "/last"},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+		if got := w.Header().Get("Location"); got != tc.want {
+			t.Fatalf("request for %q redirected to %q, expected %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestServeRedirectsRegexpRest(t *testing.T) {
+	// regexps run after their literal prefixes must match as they would run
+	// on the whole path
+	testCases := []struct {
+		pattern string
+		url     string
+	}{
+		{pattern: `^/a/(\w+)\.html$`, url: "/b/$1"},
+		{pattern: `^/a/(?P<name>\w+)/(x)?`, url: "/b/${name}/$2/$0"},
+		{pattern: `^/a/(?i)ID/(\d+)`, url: "/b/$1"},
+		{pattern: `^/a/\b(\w+)`, url: "/b/$1"},
+		{pattern: `^/a/\B(\w+)`, url: "/b/$1"},
+		{pattern: `(?m)^/a/^(\w*)`, url: "/b/$1"},
+		{pattern: `^/a/(.*?)(\d*)$`, url: "/b/$1-$2"},
+		{pattern: `^/a/`, url: "/b/$0"},
+		{pattern: `^/a/(?P<x>\w)?(?P<y>\w*)`, url: "/b/$x-${y}z-$yz-$$1-$-${x-$01-$1x-$9-$"},
+	}
+	paths := []string{"/a/", "/a/x", "/a/page.html", "/a/name/x/y", "/a/id/12", "/a/ID/34", "/a/_x9", "/b/x"}
+
+	for _, tc := range testCases {
+		re := regexp.MustCompile(tc.pattern)
+		h, err := handy.NewRedirectHandler(nil, handy.RedirectOptions{
+			Regexps: []handy.RegexpRedirect{{Pattern: tc.pattern, Redirect: handy.Redirect{URL: tc.url}}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %+v", tc.pattern, err)
+		}
+		for _, path := range paths {
+			var want string
+			if m := re.FindStringSubmatchIndex(path); m != nil {
+				want = string(re.ExpandString(nil, tc.url, path, m))
+			}
+			if got, _, _ := h.Lookup(httptest.NewRequest("GET", path, nil)); got != want {
+				t.Errorf("%q: request for %q redirected to %q, expected %q", tc.pattern, path, got, want)
+			}
+		}
+	}
+}
+
+// benchmarkRedirects is the size of the table for the lookup benchmarks. On
+// a single core of a typical server, exact matches take around 200ns and
+// misses 300ns at this size. Prefix matches take around 700ns and regexp
+// matches around 1µs, of which a third is running the regexp that matches;
+// most of the rest is waiting on memory. Both grow with the number of
+// segments in the path rather than the size of the table.
+const benchmarkRedirects = 500000
+
+// benchmarkLookup measures looking up redirects for requests to paths, each
+// of which should be redirected unless wantMiss is set.
+func benchmarkLookup(b *testing.B, redirects map[string]handy.Redirect, opts handy.RedirectOptions, paths []string, wantMiss bool) {
+	h, err := handy.NewRedirectHandler(redirects, opts)
+	if err != nil {
+		b.Fatalf("unexpected error creating handler: %+v", err)
+	}
+	reqs := make([]*http.Request, len(paths))
+	for i, path := range paths {
+		reqs[i] = httptest.NewRequest("GET", path, nil)
+		if _, _, ok := h.Lookup(reqs[i]); ok == wantMiss {
+			b.Fatalf("lookup for %q found redirect %t, expected %t", path, ok, !wantMiss)
+		}
+	}
+	runtime.GC() // collect the garbage from building the table
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Lookup(reqs[i%len(reqs)])
+	}
+}
+
+// benchmarkPaths formats paths with random numbers below n that have the
+// given remainder when divided by 2, or any if odd is negative.
+func benchmarkPaths(format string, n, odd int) []string {
+	rnd := rand.New(rand.NewSource(1))
+	paths := make([]string, 1024)
+	for i := range paths {
+		k := rnd.Intn(n)
+		if odd >= 0 {
+			k = k&^1 | odd
+		}
+		paths[i] = fmt.Sprintf(format, k)
+	}
+	return paths
+}
+
+// benchmarkTable mixes exact and prefix rules.
+func benchmarkTable() map[string]handy.Redirect {
+	redirects := make(map[string]handy.Redirect, benchmarkRedirects)
+	for i := 0; i < benchmarkRedirects; i++ {
+		if i%2 == 0 {
+			redirects[fmt.Sprintf("/old/%d/page", i)] = handy.Redirect{URL: fmt.Sprintf("/new/%d/page", i)}
+		} else {
+			redirects[fmt.Sprintf("/old/%d/*", i)] = handy.Redirect{URL: fmt.Sprintf("/new/%d/*", i)}
+		}
+	}
+	return redirects
+}
+
+func BenchmarkRedirectsExact(b *testing.B) {
+	benchmarkLookup(b, benchmarkTable(), handy.RedirectOptions{}, benchmarkPaths("/old/%d/page", benchmarkRedirects, 0), false)
+}
+
+func BenchmarkRedirectsPrefix(b *testing.B) {
+	benchmarkLookup(b, benchmarkTable(), handy.RedirectOptions{}, benchmarkPaths("/old/%d/some/page", benchmarkRedirects, 1), false)
+}
+
+func BenchmarkRedirectsMiss(b *testing.B) {
+	benchmarkLookup(b, benchmarkTable(), handy.RedirectOptions{}, benchmarkPaths("/old/%d/missing", benchmarkRedirects, 0), true)
+}
+
+func BenchmarkRedirectsRegexp(b *testing.B) {
+	const n = 10000
+	regexps := make([]handy.RegexpRedirect, n)
+	for i := range regexps {
+		regexps[i] = handy.RegexpRedirect{
+			Pattern:  fmt.Sprintf(`^/legacy/%d/(\w+)\.html$`, i),
+			Redirect: handy.Redirect{URL: fmt.Sprintf("/pages/%d/$1", i)},
+		}
+	}
+	opts := handy.RedirectOptions{Regexps: regexps}
+	benchmarkLookup(b, benchmarkTable(), opts, benchmarkPaths("/legacy/%d/page.html", n, -1), false)
+}
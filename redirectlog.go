@@ -0,0 +1,214 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// LogRedirectStore is an embedded RedirectStore that appends each change to
+// a log file, synced before the change is acknowledged, and replays the log
+// when opened. The log is compacted when it grows to several times the size
+// of the table, and whenever the table is replaced, so changes are cheap
+// however large the table.
+type LogRedirectStore struct {
+	mu        sync.Mutex
+	filename  string
+	f         *os.File
+	redirects map[string]Redirect
+	records   int // in the log, to decide when to compact
+}
+
+// redirectLogRecord is a line of the log, setting the redirect for From or,
+// if To is nil, deleting it.
+type redirectLogRecord struct {
+	From string    `json:"from"`
+	To   *Redirect `json:"to,omitempty"`
+}
+
+// OpenLogRedirectStore provides a LogRedirectStore for filename, creating
+// it if it does not exist. A record left incomplete by a crash is
+// discarded. The store must be closed when no longer needed.
+func OpenLogRedirectStore(filename string) (*LogRedirectStore, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	s := &LogRedirectStore{filename: filename, redirects: make(map[string]Redirect)}
+	valid := 0 // length of the log up to the last complete record
+	for line := 1; valid < len(data); line++ {
+		end := bytes.IndexByte(data[valid:], '\n')
+		if end < 0 {
+			break // incomplete final record
+		}
+		var rec redirectLogRecord
+		if err := json.Unmarshal(data[valid:valid+end], &rec); err != nil {
+			return nil, fmt.Errorf("handy: %s line %d: %v", filename, line, err)
+		}
+		s.apply(rec)
+		valid += end + 1
+	}
+	s.f, err = os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.f.Truncate(int64(valid)); err != nil {
+		s.f.Close()
+		return nil, err
+	}
+	if _, err := s.f.Seek(int64(valid), io.SeekStart); err != nil {
+		s.f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load returns the current redirects.
+func (s *LogRedirectStore) Load() (map[string]Redirect, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyRedirects(s.redirects), nil
+}
+
+// Set stores the redirect for from.
+func (s *LogRedirectStore) Set(from string, to Redirect) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.append(redirectLogRecord{From: from, To: &to})
+}
+
+// Delete removes the redirect for from.
+func (s *LogRedirectStore) Delete(from string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.redirects[from]; !ok {
+		return nil
+	}
+	return s.append(redirectLogRecord{From: from})
+}
+
+// Replace stores redirects in place of the whole table, rewriting the log.
+func (s *LogRedirectStore) Replace(redirects map[string]Redirect) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact(copyRedirects(redirects))
+}
+
+// Close closes the log file. The store may not be used afterwards.
+func (s *LogRedirectStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return errors.New("handy: redirect log already closed")
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *LogRedirectStore) apply(rec redirectLogRecord) {
+	if rec.To == nil {
+		delete(s.redirects, rec.From)
+	} else {
+		s.redirects[rec.From] = *rec.To
+	}
+	s.records++
+}
+
+// append writes rec to the log and applies it, or rewrites the log with the
+// change if it has grown too long.
+func (s *LogRedirectStore) append(rec redirectLogRecord) error {
+	if s.f == nil {
+		return errors.New("handy: redirect log closed")
+	}
+	if s.records >= 4*len(s.redirects)+64 {
+		redirects := copyRedirects(s.redirects)
+		if rec.To == nil {
+			delete(redirects, rec.From)
+		} else {
+			redirects[rec.From] = *rec.To
+		}
+		return s.compact(redirects)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	end, err := s.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(line, '\n'))
+	if err == nil {
+		err = s.f.Sync()
+	}
+	if err != nil {
+		s.truncate(end)
+		return err
+	}
+	s.apply(rec)
+	return nil
+}
+
+// truncate discards anything written to the log after end, such as part of
+// a record that failed, so that it is not replayed when the log is opened.
+// If the log cannot be truncated, the store is closed rather than left to
+// append after a bad record.
+func (s *LogRedirectStore) truncate(end int64) {
+	err := s.f.Truncate(end)
+	if err == nil {
+		_, err = s.f.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		s.f.Close()
+		s.f = nil
+	}
+}
+
+// compact rewrites the log with a record for each of redirects. The new log
+// is open before it replaces the old, so that if either fails the store is
+// left as it was. Once the log is replaced the change is kept, even if the
+// directory then fails to sync.
+func (s *LogRedirectStore) compact(redirects map[string]Redirect) error {
+	if s.f == nil {
+		return errors.New("handy: redirect log closed")
+	}
+	sources := make([]string, 0, len(redirects))
+	for from := range redirects {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+	var buf bytes.Buffer
+	for _, from := range sources {
+		to := redirects[from]
+		line, err := json.Marshal(redirectLogRecord{From: from, To: &to})
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	f, err := writeTempFile(s.filename, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), s.filename); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	s.f.Close()
+	s.f = f
+	s.redirects = redirects
+	s.records = len(redirects)
+	return syncDir(s.filename)
+}
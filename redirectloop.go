@@ -0,0 +1,155 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxRedirectHops is the longest chain of redirects allowed from a source.
+// Clients give up well before this; net/http stops after 10.
+const maxRedirectHops = 32
+
+// RedirectLoopError reports a chain of redirects that never ends, either
+// because it returns to a URL already visited or because it is too long.
+type RedirectLoopError struct {
+	// Chain lists each URL visited, starting with the redirect source.
+	Chain []string
+}
+
+func (e *RedirectLoopError) Error() string {
+	if len(e.Chain) > maxRedirectHops {
+		return fmt.Sprintf("handy: more than %d redirects from %q", maxRedirectHops, e.Chain[0])
+	}
+	return "handy: redirect loop " + strings.Join(e.Chain, " -> ")
+}
+
+// isExactRedirectSource reports whether from is the source of a redirect for
+// a single URL, with no wildcards in the host or path.
+func isExactRedirectSource(from string) bool {
+	host, urlPath := splitRedirectSource(from)
+	return urlPath != "" && !strings.HasPrefix(host, "*") && !isRedirectPattern(from)
+}
+
+// check follows the chain of redirects from each of the exact sources, or
+// all of them if sources is nil, returning a *RedirectLoopError for the
+// first that never ends, whenever its redirects are scheduled.
+func (rules *redirectRules) check(sources []string) error {
+	if sources == nil {
+		for from := range rules.redirects {
+			if isExactRedirectSource(from) {
+				sources = append(sources, from)
+			}
+		}
+		sort.Strings(sources) // report the same loop every time
+	}
+	for _, from := range sources {
+		if _, _, err := rules.follow(from, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flatten records the end of the chain of redirects from each exact source
+// that starts one, leaving the table itself as it is. It must be called
+// again whenever the rules change, and only once check has found no loops.
+// A chain is only flattened as far as the first scheduled redirect after
+// its source, which may not apply whenever the source does.
+func (rules *redirectRules) flatten() {
+	rules.flat = make(map[string]string)
+	for from := range rules.redirects {
+		if !isExactRedirectSource(from) {
+			continue
+		}
+		if dest, hops, err := rules.follow(from, true); err == nil && hops > 1 {
+			rules.flat[from] = dest
+		}
+	}
+}
+
+// follow traces the chain of redirects from the exact source from, returning
+// the final destination and the number of redirects along the way. Absolute
+// destinations are only followed for hosts with redirects of their own. If
+// unscheduled is set, the chain ends before any scheduled redirect after
+// the first.
+func (rules *redirectRules) follow(from string, unscheduled bool) (string, int, error) {
+	host, urlPath := splitRedirectSource(from)
+	chain := []string{from}
+	visited := map[string]bool{from: true}
+	var (
+		abs  *url.URL // the last absolute destination
+		last *url.URL // the last destination
+	)
+	for hops := 0; ; hops++ {
+		m, ok := rules.match(host, urlPath, time.Time{})
+		if !ok || (unscheduled && hops > 0 && m.rd.scheduled()) {
+			break
+		}
+		u, err := url.Parse(m.dest)
+		if err != nil {
+			return m.dest, hops + 1, nil
+		}
+		if u.Host != "" {
+			destHost := strings.ToLower(u.Hostname())
+			if !rules.servesHost(destHost) {
+				return m.dest, hops + 1, nil
+			}
+			host, urlPath, abs = destHost, u.Path, u
+			if urlPath == "" {
+				urlPath = "/"
+			}
+		} else {
+			urlPath = resolveRedirectPath(urlPath, u.Path)
+		}
+		last = u
+		key := host + urlPath
+		chain = append(chain, key)
+		if visited[key] || hops == maxRedirectHops {
+			return "", hops + 1, &RedirectLoopError{chain}
+		}
+		visited[key] = true
+	}
+	if last == nil {
+		return "", 0, nil
+	}
+	final := &url.URL{Path: urlPath, RawQuery: last.RawQuery, Fragment: last.Fragment}
+	if abs != nil {
+		final.Scheme, final.Host = abs.Scheme, abs.Host
+	}
+	return final.String(), len(chain) - 1, nil
+}
+
+// servesHost reports whether host, or a wildcard matching it, has redirects.
+func (rules *redirectRules) servesHost(host string) bool {
+	if rules.hosts[host] > 0 {
+		return true
+	}
+	for _, wildcard := range wildcardHosts(host) {
+		if rules.hosts[wildcard] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRedirectPath resolves ref against the request path cur, the same
+// way http.Redirect does.
+func resolveRedirectPath(cur, ref string) string {
+	if ref == "" || ref[0] != '/' {
+		dir, _ := path.Split(cur)
+		ref = dir + ref
+	}
+	trailing := strings.HasSuffix(ref, "/")
+	ref = path.Clean(ref)
+	if trailing && !strings.HasSuffix(ref, "/") {
+		ref += "/"
+	}
+	return ref
+}
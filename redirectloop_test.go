@@ -0,0 +1,187 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestRedirectLoops(t *testing.T) {
+	longChain := make(map[string]handy.Redirect)
+	for i := 0; i < 40; i++ {
+		longChain[fmt.Sprintf("/%d", i)] = handy.Redirect{URL: fmt.Sprintf("/%d", i+1)}
+	}
+
+	testCases := []struct {
+		name      string
+		redirects map[string]handy.Redirect
+		regexps   []handy.RegexpRedirect
+		wantChain []string
+	}{
+		{"self",
+			map[string]handy.Redirect{"/a": {URL: "/a"}},
+			nil,
+			[]string{"/a", "/a"},
+		},
+		{"pair",
+			map[string]handy.Redirect{"/a": {URL: "/b"}, "/b": {URL: "/a"}},
+			nil,
+			nil,
+		},
+		{"relative",
+			map[string]handy.Redirect{"/x/a": {URL: "b"}, "/x/b": {URL: "../x/a?q=1"}},
+			nil,
+			nil,
+		},
+		{"through pattern",
+			map[string]handy.Redirect{"/a": {URL: "/docs/v1/a"}, "/docs/v1/*": {URL: "/*"}},
+			nil,
+			nil,
+		},
+		{"growing pattern",
+			map[string]handy.Redirect{"/x/a": {URL: "/x/y/a"}, "/x/*": {URL: "/x/y/*"}},
+			nil,
+			nil,
+		},
+		{"through regexp",
+			map[string]handy.Redirect{"/user/1": {URL: "/u/1"}},
+			[]handy.RegexpRedirect{{Pattern: `^/u/(\d+)$`, Redirect: handy.Redirect{URL: "/user/$1"}}},
+			nil,
+		},
+		{"through host",
+			map[string]handy.Redirect{
+				"/a":                {URL: "https://www.example.com/b"},
+				"www.example.com/b": {URL: "https://example.com/c"},
+				"example.com/c":     {URL: "https://www.example.com/b"},
+			},
+			nil,
+			[]string{"/a", "www.example.com/b", "example.com/c", "www.example.com/b"},
+		},
+		{"whole host",
+			map[string]handy.Redirect{"www.example.com": {URL: "https://www.example.com"}},
+			nil,
+			nil,
+		},
+		{"long chain",
+			longChain,
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := handy.NewRedirectHandler(tc.redirects, handy.RedirectOptions{Regexps: tc.regexps})
+			loop, ok := err.(*handy.RedirectLoopError)
+			if !ok {
+				t.Fatalf("constructing handler returned %v, expected a *RedirectLoopError", err)
+			}
+			if tc.wantChain != nil && !reflect.DeepEqual(loop.Chain, tc.wantChain) {
+				t.Fatalf("loop has chain %q, expected %q", loop.Chain, tc.wantChain)
+			}
+		})
+	}
+}
+
+func TestRedirectLoopsAtRuntime(t *testing.T) {
+	redirects := map[string]handy.Redirect{
+		"/a": {URL: "/b"},
+		"/b": {URL: "/c"},
+		"/d": {URL: "https://elsewhere.example.com/a"},
+	}
+	h := handy.ServeRedirects(redirects, handy.RedirectOptions{})
+
+	if err := h.Set("/c", handy.Redirect{URL: "/a"}); err == nil {
+		t.Fatalf("expected error setting redirect loop")
+	}
+	if err := h.Set("/b", handy.Redirect{URL: "/a"}); err == nil {
+		t.Fatalf("expected error changing redirect into loop")
+	}
+	if err := h.Set("/*", handy.Redirect{URL: "/a"}); err == nil {
+		t.Fatalf("expected error setting pattern loop")
+	}
+	if err := h.Replace(map[string]handy.Redirect{"/a": {URL: "/a/"}, "/a/": {URL: "/a"}}); err == nil {
+		t.Fatalf("expected error replacing with redirect loop")
+	}
+	if err := h.SetRegexps([]handy.RegexpRedirect{{Pattern: `^/c$`, Redirect: handy.Redirect{URL: "/a"}}}); err == nil {
+		t.Fatalf("expected error setting regexp loop")
+	}
+	if got := h.Snapshot(); !reflect.DeepEqual(got, redirects) {
+		t.Fatalf("redirects %+v after loops, expected %+v", got, redirects)
+	}
+	if err := h.Set("/c", handy.Redirect{URL: "/e"}); err != nil {
+		t.Fatalf("unexpected error extending chain: %+v", err)
+	}
+}
+
+func TestRedirectFlatten(t *testing.T) {
+	redirects := map[string]handy.Redirect{
+		"/a":                {URL: "/b", Code: http.StatusFound},
+		"/b":                {URL: "/c?from=b#top"},
+		"/c":                {URL: "/final?from=c"},
+		"/x/one":            {URL: "two"},
+		"/x/two":            {URL: "/docs/v1/three"},
+		"/docs/v1/*":        {URL: "/docs/v2/*"},
+		"/abs":              {URL: "https://www.example.com/old"},
+		"www.example.com/*": {URL: "https://example.com/*"},
+		"/external":         {URL: "https://other.example.com/a"},
+	}
+	h := handy.ServeRedirects(redirects, handy.RedirectOptions{Flatten: true})
+
+	lookup := func(path string) (string, int) {
+		url, code, _ := h.Lookup(httptest.NewRequest("GET", path, nil))
+		return url, code
+	}
+	testCases := []struct {
+		path     string
+		wantURL  string
+		wantCode int
+	}{
+		{"/a", "/final?from=c", http.StatusFound},
+		{"/b", "/final?from=c", http.StatusMovedPermanently},
+		{"/c", "/final?from=c", http.StatusMovedPermanently},
+		{"/x/one", "/docs/v2/three", http.StatusMovedPermanently},
+		{"/x/two", "/docs/v2/three", http.StatusMovedPermanently},
+		{"/docs/v1/four", "/docs/v2/four", http.StatusMovedPermanently},
+		{"/abs", "https://example.com/old", http.StatusMovedPermanently},
+		{"/external", "https://other.example.com/a", http.StatusMovedPermanently},
+	}
+	for _, tc := range testCases {
+		if url, code := lookup(tc.path); url != tc.wantURL || code != tc.wantCode {
+			t.Fatalf("request for %q redirected with %d to %q, expected %d to %q", tc.path, code, url, tc.wantCode, tc.wantURL)
+		}
+	}
+
+	// the table is kept as given, so that chains follow later changes
+	if got := h.Snapshot(); !reflect.DeepEqual(got, redirects) {
+		t.Fatalf("redirects %+v after flattening, expected %+v", got, redirects)
+	}
+	if err := h.Set("/b", handy.Redirect{URL: "/d"}); err != nil {
+		t.Fatalf("unexpected error changing chain: %+v", err)
+	}
+	if url, _ := lookup("/a"); url != "/d" {
+		t.Fatalf("request for /a redirected to %q after changing chain, expected /d", url)
+	}
+	if err := h.Set("/d", handy.Redirect{URL: "/really-final"}); err != nil {
+		t.Fatalf("unexpected error extending chain: %+v", err)
+	}
+	for _, from := range []string{"/a", "/b", "/d"} {
+		if url, _ := lookup(from); url != "/really-final" {
+			t.Fatalf("request for %q redirected to %q after extending chain, expected /really-final", from, url)
+		}
+	}
+	if err := h.Delete("/d"); err != nil {
+		t.Fatalf("unexpected error deleting redirect: %+v", err)
+	}
+	if url, _ := lookup("/a"); url != "/d" {
+		t.Fatalf("request for /a redirected to %q after shortening chain, expected /d", url)
+	}
+}
@@ -0,0 +1,494 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// splitRedirectSource splits a redirect source into its host and path. A
+// source starting with / has no host, and one with no / has no path.
+func splitRedirectSource(from string) (host, urlPath string) {
+	i := strings.IndexByte(from, '/')
+	if i < 0 {
+		return from, ""
+	}
+	return from[:i], from[i:]
+}
+
+// canonicalRedirectSource lowercases the host of a redirect source, since
+// hosts are matched without regard to case.
+func canonicalRedirectSource(from string) string {
+	host, urlPath := splitRedirectSource(from)
+	return strings.ToLower(host) + urlPath
+}
+
+// matchHost reports whether host matches pattern, which may be a wildcard
+// such as *.example.com matching any subdomain of example.com.
+func matchHost(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return pattern == host
+}
+
+// wildcardHosts returns the wildcard host patterns that match host, from
+// most to least specific.
+func wildcardHosts(host string) []string {
+	var hosts []string
+	for i, c := range host {
+		if c == '.' {
+			hosts = append(hosts, "*"+host[i:])
+		}
+	}
+	return hosts
+}
+
+// requestHost returns the lowercased host of r, without any port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if strings.IndexByte(host, ':') >= 0 {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	return strings.ToLower(host)
+}
+
+// redirectPattern is a redirect whose source matches more than one path.
+//
+// A source with a path ending in * and no other wildcards is a prefix rule:
+// it matches any path starting with the rest of the source, and a * ending
+// the destination URL is replaced by the remainder of the path. Any other
+// source with a path containing *, ?, or [ is a glob rule, matched with
+// path.Match. Either may be limited to a host.
+type redirectPattern struct {
+	from   string
+	host   string
+	path   string
+	prefix string
+	glob   bool
+	rd     Redirect
+}
+
+// isRedirectPattern reports whether from is a prefix or glob source.
+func isRedirectPattern(from string) bool {
+	_, urlPath := splitRedirectSource(from)
+	return strings.ContainsAny(urlPath, "*?[")
+}
+
+func newRedirectPattern(from string, rd Redirect) (redirectPattern, error) {
+	host, urlPath := splitRedirectSource(from)
+	p := redirectPattern{from: from, host: host, path: urlPath, rd: rd}
+	if prefix := strings.TrimSuffix(urlPath, "*"); !strings.ContainsAny(prefix, "*?[") {
+		p.prefix = prefix
+		return p, nil
+	}
+	if _, err := path.Match(urlPath, ""); err != nil {
+		return p, fmt.Errorf("handy: invalid redirect pattern %q: %v", from, err)
+	}
+	p.glob = true
+	return p, nil
+}
+
+// match returns the destination URL for the request, if the pattern
+// matches it. The rest of the path added by a prefix rule is taken from
+// original, which is urlPath before any change of case. Runes are counted
+// rather than bytes, as a change of case may change the length of a rune.
+func (p redirectPattern) match(host, urlPath, original string) (string, bool) {
+	if p.host != "" && !matchHost(p.host, host) {
+		return "", false
+	}
+	if p.glob {
+		ok, _ := path.Match(p.path, urlPath)
+		return p.rd.URL, ok
+	}
+	if !strings.HasPrefix(urlPath, p.prefix) {
+		return "", false
+	}
+	if strings.HasSuffix(p.rd.URL, "*") {
+		rest := original
+		for matched := urlPath[:len(p.prefix)]; matched != ""; {
+			_, n := utf8.DecodeRuneInString(matched)
+			_, m := utf8.DecodeRuneInString(rest)
+			matched, rest = matched[n:], rest[m:]
+		}
+		return strings.TrimSuffix(p.rd.URL, "*") + rest, true
+	}
+	return p.rd.URL, true
+}
+
+// compileRedirectPatterns indexes the patterns in redirects.
+func compileRedirectPatterns(redirects map[string]Redirect) (patternIndex, error) {
+	idx := newPatternIndex()
+	for from, rd := range redirects {
+		if !isRedirectPattern(from) {
+			continue
+		}
+		p, err := newRedirectPattern(from, rd)
+		if err != nil {
+			return idx, err
+		}
+		idx.add(p)
+	}
+	return idx, nil
+}
+
+// regexpRedirect is a compiled RegexpRedirect.
+//
+// A regexp anchored to the start of the path is split, where it can be,
+// into the literal text it starts with and a regexp for the rest, compiled
+// once for all the regexps with the same rest. Only that is run, on the path
+// after the prefix, so a large set of regexps that differ only in their
+// prefixes shares a single program that stays in cache.
+type regexpRedirect struct {
+	RegexpRedirect
+	rule     string // ~ and the pattern, as reported in a redirectMatch
+	anchored bool   // whether it only matches at the start of the path
+	prefix   string // the literal text any match starts with, if anchored
+	re       *regexp.Regexp
+	skip     int         // the length of the prefix, if re is for the rest
+	template urlTemplate // if the URL refers to submatches
+	order    int         // its place in a regexpSet
+}
+
+func compileRegexpRedirects(regexps []RegexpRedirect) ([]regexpRedirect, error) {
+	compiled := make([]regexpRedirect, len(regexps))
+	shared := make(map[string]*regexp.Regexp)
+	for i, rr := range regexps {
+		re, err := regexp.Compile(rr.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("handy: invalid redirect regexp %q: %v", rr.Pattern, err)
+		}
+		if err := validateRedirectTarget(rr.Pattern, rr.Redirect); err != nil {
+			return nil, err
+		}
+		c := regexpRedirect{RegexpRedirect: rr, rule: "~" + rr.Pattern, re: re}
+		if strings.Contains(rr.URL, "$") {
+			c.template = parseURLTemplate(rr.URL)
+		}
+		var rest string
+		c.prefix, rest, c.anchored = anchoredPrefix(rr.Pattern)
+		if rest != "" {
+			restRe := shared[rest]
+			if restRe == nil {
+				if restRe, err = regexp.Compile(rest); err != nil || restRe.NumSubexp() != re.NumSubexp() {
+					restRe = re // run as written
+				} else {
+					shared[rest] = restRe
+				}
+			}
+			if restRe != re {
+				c.re, c.skip = restRe, len(c.prefix)
+			}
+		}
+		compiled[i] = c
+	}
+	return compiled, nil
+}
+
+// match returns the expanded destination URL, if the regexp matches urlPath,
+// which must start with the prefix of an anchored regexp, as it does for
+// those found by a regexpSet.
+func (rr *regexpRedirect) match(urlPath string) (string, bool) {
+	if rr.template == nil {
+		return rr.URL, rr.re.MatchString(urlPath[rr.skip:])
+	}
+	m := rr.re.FindStringSubmatchIndex(urlPath[rr.skip:])
+	if m == nil {
+		return "", false
+	}
+	if rr.skip > 0 {
+		// the submatches are found after the prefix, but the whole match
+		// starts with it
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += rr.skip
+			}
+		}
+		m[0] = 0
+	}
+	var buf [128]byte
+	return string(rr.template.expand(buf[:0], rr.re.SubexpNames(), urlPath, m)), true
+}
+
+// urlTemplate is a destination URL that refers to submatches, parsed as
+// regexp.Regexp.Expand parses it, so that it is not parsed for every
+// request.
+type urlTemplate []templatePart
+
+// templatePart is literal text followed by the submatch with the number
+// group or, if name is set, the first with that name that matched.
+type templatePart struct {
+	text  string
+	group int // negative for none
+	name  string
+}
+
+func parseURLTemplate(template string) urlTemplate {
+	var (
+		t    urlTemplate
+		text []byte
+	)
+	for {
+		i := strings.IndexByte(template, '$')
+		if i < 0 {
+			break
+		}
+		text = append(text, template[:i]...)
+		template = template[i+1:]
+		if strings.HasPrefix(template, "$") {
+			text = append(text, '$')
+			template = template[1:]
+			continue
+		}
+		name, num, rest, ok := extractTemplateName(template)
+		if !ok {
+			text = append(text, '$') // malformed, so kept as text
+			continue
+		}
+		part := templatePart{text: string(text), group: num}
+		if num < 0 {
+			part.name = name
+		}
+		t = append(t, part)
+		text, template = text[:0], rest
+	}
+	return append(t, templatePart{text: string(text) + template, group: -1})
+}
+
+// extractTemplateName parses a submatch name or number from the start of
+// str, following a $, just as regexp.Regexp.Expand does.
+func extractTemplateName(str string) (name string, num int, rest string, ok bool) {
+	brace := strings.HasPrefix(str, "{")
+	if brace {
+		str = str[1:]
+	}
+	i := 0
+	for i < len(str) {
+		r, size := utf8.DecodeRuneInString(str[i:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		i += size
+	}
+	if i == 0 {
+		return "", 0, "", false
+	}
+	name = str[:i]
+	if brace {
+		if i >= len(str) || str[i] != '}' {
+			return "", 0, "", false
+		}
+		i++
+	}
+	for j := 0; j < len(name); j++ {
+		if name[j] < '0' || '9' < name[j] || num >= 1e8 {
+			num = -1
+			break
+		}
+		num = num*10 + int(name[j]-'0')
+	}
+	if name[0] == '0' && len(name) > 1 {
+		num = -1 // no leading zeros
+	}
+	return name, num, str[i:], true
+}
+
+// expand appends t to dst, with the submatches of src given by match, whose
+// names are names.
+func (t urlTemplate) expand(dst []byte, names []string, src string, match []int) []byte {
+	for _, part := range t {
+		dst = append(dst, part.text...)
+		group := part.group
+		if part.name != "" {
+			for i, name := range names {
+				if name == part.name && 2*i+1 < len(match) && match[2*i] >= 0 {
+					group = i
+					break
+				}
+			}
+		}
+		if group >= 0 && 2*group+1 < len(match) && match[2*group] >= 0 {
+			dst = append(dst, src[match[2*group]:match[2*group+1]]...)
+		}
+	}
+	return dst
+}
+
+// validateHostRedirect checks that a redirect for a whole host sends
+// requests to another host.
+func validateHostRedirect(from string, rd Redirect) error {
+	u, err := url.Parse(rd.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("handy: redirect for host %q must be to an absolute URL, not %q", from, rd.URL)
+	}
+	if matchHost(strings.ToLower(from), strings.ToLower(u.Hostname())) {
+		return &RedirectLoopError{[]string{from, rd.URL}}
+	}
+	return nil
+}
+
+// redirectRules is a redirect table along with the patterns compiled from
+// it and any regular expressions.
+type redirectRules struct {
+	redirects map[string]Redirect
+	patterns  patternIndex
+	regexps   regexpSet
+	hosts     map[string]int    // sources for each host, including wildcards
+	flat      map[string]string // the ends of chains from exact sources, if flattened
+	norm      pathNormalization
+	scheduled int // redirects limited to some time
+}
+
+// newRedirectRules validates redirects and builds rules for a copy of them,
+// with canonical sources. Sources that are the same once normalized are
+// an error.
+func newRedirectRules(redirects map[string]Redirect, norm pathNormalization) (redirectRules, error) {
+	table := make(map[string]Redirect, len(redirects))
+	given := make(map[string]string, len(redirects))
+	for from, to := range redirects {
+		canonical, err := norm.source(from)
+		if err != nil {
+			return redirectRules{}, err
+		}
+		if err := validateRedirect(canonical, to); err != nil {
+			return redirectRules{}, err
+		}
+		if other, ok := given[canonical]; ok {
+			if other > from {
+				other, from = from, other
+			}
+			return redirectRules{}, fmt.Errorf("handy: redirects for %q and %q have the same source %q", other, from, canonical)
+		}
+		given[canonical] = from
+		table[canonical] = to
+	}
+	patterns, err := compileRedirectPatterns(table)
+	if err != nil {
+		return redirectRules{}, err
+	}
+	rules := redirectRules{redirects: table, patterns: patterns, hosts: make(map[string]int), norm: norm}
+	for from, to := range table {
+		rules.countHost(from, 1)
+		if to.scheduled() {
+			rules.scheduled++
+		}
+	}
+	return rules, nil
+}
+
+// set adds or changes the redirect for the canonical source from.
+func (rules *redirectRules) set(from string, to Redirect) {
+	if prev, ok := rules.redirects[from]; !ok {
+		rules.countHost(from, 1)
+	} else if prev.scheduled() {
+		rules.scheduled--
+	}
+	if to.scheduled() {
+		rules.scheduled++
+	}
+	rules.redirects[from] = to
+	if isRedirectPattern(from) {
+		p, _ := newRedirectPattern(from, to) // validated by the caller
+		rules.patterns.remove(from)
+		rules.patterns.add(p)
+	}
+}
+
+// delete removes the redirect for the canonical source from.
+func (rules *redirectRules) delete(from string) {
+	if prev, ok := rules.redirects[from]; ok {
+		rules.countHost(from, -1)
+		if prev.scheduled() {
+			rules.scheduled--
+		}
+	}
+	delete(rules.redirects, from)
+	if isRedirectPattern(from) {
+		rules.patterns.remove(from)
+	}
+}
+
+// countHost adds delta to the number of sources for the host of from.
+func (rules *redirectRules) countHost(from string, delta int) {
+	host, _ := splitRedirectSource(from)
+	if host == "" {
+		return
+	}
+	if rules.hosts[host] += delta; rules.hosts[host] <= 0 {
+		delete(rules.hosts, host)
+	}
+}
+
+// redirectMatch is the redirect found for a request.
+type redirectMatch struct {
+	rule string   // the source, or ~ and the pattern of a regexp
+	dest string   // the destination URL
+	rd   Redirect // the matching redirect
+}
+
+// match finds the redirect for a request to host and urlPath at now, or at
+// any time if now is zero. Exact sources for the host are preferred, then
+// exact sources for any host, patterns, regular expressions, and finally
+// redirects for the whole host.
+func (rules *redirectRules) match(host, urlPath string, now time.Time) (redirectMatch, bool) {
+	urlPath, matching, original := rules.norm.request(urlPath)
+	// the table is only searched for hosts with sources of their own
+	if rules.hosts[host] > 0 {
+		if rd, ok := rules.redirects[host+urlPath]; ok && rd.activeAt(now) {
+			return redirectMatch{host + urlPath, rd.URL, rd}, true
+		}
+	}
+	for i := 0; i < len(host) && len(rules.hosts) > 0; i++ {
+		if host[i] != '.' || rules.hosts["*"+host[i:]] == 0 {
+			continue
+		}
+		if rd, ok := rules.redirects["*"+host[i:]+urlPath]; ok && rd.activeAt(now) {
+			return redirectMatch{"*" + host[i:] + urlPath, rd.URL, rd}, true
+		}
+	}
+	if rd, ok := rules.redirects[urlPath]; ok && rd.activeAt(now) {
+		return redirectMatch{urlPath, rd.URL, rd}, true
+	}
+	if p, ok := rules.patterns.match(host, matching, now); ok {
+		dest, _ := p.match(host, matching, original)
+		return redirectMatch{p.from, dest, p.rd}, true
+	}
+	if rr, dest, ok := rules.regexps.match(original, now); ok {
+		return redirectMatch{rr.rule, dest, rr.Redirect}, true
+	}
+	if rules.hosts[host] > 0 {
+		if rd, ok := rules.redirects[host]; ok && rd.activeAt(now) {
+			return hostRedirectMatch(host, rd, original), true
+		}
+	}
+	for i := 0; i < len(host) && len(rules.hosts) > 0; i++ {
+		if host[i] != '.' || rules.hosts["*"+host[i:]] == 0 {
+			continue
+		}
+		if rd, ok := rules.redirects["*"+host[i:]]; ok && rd.activeAt(now) {
+			return hostRedirectMatch("*"+host[i:], rd, original), true
+		}
+	}
+	return redirectMatch{}, false
+}
+
+// hostRedirectMatch is the match for a redirect of the whole host, which
+// keeps the path and, by default, the query.
+func hostRedirectMatch(from string, rd Redirect, urlPath string) redirectMatch {
+	if rd.Query == QueryDefault {
+		rd.Query = QueryPass
+	}
+	return redirectMatch{from, strings.TrimSuffix(rd.URL, "/") + urlPath, rd}
+}
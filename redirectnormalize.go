@@ -0,0 +1,92 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// pathNormalization makes variants of a path equivalent when matching
+// redirects, as set by RedirectOptions.
+type pathNormalization struct {
+	ignoreCase      bool
+	trailingSlash   bool
+	decode          bool
+	collapseSlashes bool
+}
+
+// source returns the canonical form of the redirect source from, with the
+// host lowercased and the path normalized.
+func (n pathNormalization) source(from string) (string, error) {
+	host, urlPath := splitRedirectSource(canonicalRedirectSource(from))
+	if urlPath == "" {
+		return host, nil
+	}
+	if n.decode {
+		decoded, err := url.PathUnescape(urlPath)
+		if err != nil {
+			return "", fmt.Errorf("handy: invalid redirect source %q: %v", from, err)
+		}
+		urlPath = decoded
+	}
+	urlPath = n.path(urlPath)
+	if n.trailingSlash && !isRedirectPattern(urlPath) {
+		urlPath = trimTrailingSlash(urlPath)
+	}
+	return host + urlPath, nil
+}
+
+// path normalizes the case and slashes of a path.
+func (n pathNormalization) path(urlPath string) string {
+	if n.collapseSlashes {
+		urlPath = collapseSlashes(urlPath)
+	}
+	if n.ignoreCase {
+		urlPath = strings.ToLower(urlPath)
+	}
+	return urlPath
+}
+
+// request normalizes the path of a request, returning the path to look up
+// exact sources with, the path to match patterns with, and the latter
+// before any change of case.
+func (n pathNormalization) request(urlPath string) (exact, matching, original string) {
+	if n.collapseSlashes {
+		urlPath = collapseSlashes(urlPath)
+	}
+	original, matching = urlPath, urlPath
+	if n.ignoreCase {
+		matching = strings.ToLower(urlPath)
+	}
+	exact = matching
+	if n.trailingSlash {
+		exact = trimTrailingSlash(exact)
+	}
+	return exact, matching, original
+}
+
+// collapseSlashes replaces each run of slashes in urlPath with one.
+func collapseSlashes(urlPath string) string {
+	if !strings.Contains(urlPath, "//") {
+		return urlPath
+	}
+	b := make([]byte, 0, len(urlPath))
+	for i := 0; i < len(urlPath); i++ {
+		if urlPath[i] == '/' && i > 0 && urlPath[i-1] == '/' {
+			continue
+		}
+		b = append(b, urlPath[i])
+	}
+	return string(b)
+}
+
+// trimTrailingSlash removes any trailing slash, except from the root.
+func trimTrailingSlash(urlPath string) string {
+	if len(urlPath) > 1 && strings.HasSuffix(urlPath, "/") {
+		return urlPath[:len(urlPath)-1]
+	}
+	return urlPath
+}
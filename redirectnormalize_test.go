@@ -0,0 +1,103 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestServeRedirectsNormalized(t *testing.T) {
+	redirects := map[string]handy.Redirect{
+		"/Pricing":          {URL: "/plans"},
+		"/about/":           {URL: "/company"},
+		"/caf%C3%A9":        {URL: "/coffee"},
+		"/docs//v1/*":       {URL: "/manual/*"},
+		"/k/*":              {URL: "/m/*"},
+		"Example.com/Login": {URL: "/signin"},
+		"/":                 {URL: "/home"},
+	}
+
+	testCases := []struct {
+		name     string
+		opts     handy.RedirectOptions
+		path     string
+		wantCode int
+		wantURL  string
+	}{
+		{"exact by default", handy.RedirectOptions{}, "/Pricing", http.StatusMovedPermanently, "/plans"},
+		{"case by default", handy.RedirectOptions{}, "/pricing", http.StatusNotFound, ""},
+		{"slash by default", handy.RedirectOptions{}, "/about", http.StatusNotFound, ""},
+		{"encoded by default", handy.RedirectOptions{}, "/café", http.StatusNotFound, ""},
+		{"slashes by default", handy.RedirectOptions{}, "/docs/v1/intro", http.StatusNotFound, ""},
+
+		{"ignore case", handy.RedirectOptions{IgnoreCase: true}, "/PRICING", http.StatusMovedPermanently, "/plans"},
+		{"ignore case with host", handy.RedirectOptions{IgnoreCase: true}, "/login", http.StatusMovedPermanently, "/signin"},
+		{"ignore case keeps prefix remainder", handy.RedirectOptions{IgnoreCase: true, CollapseSlashes: true}, "/Docs/V1/Intro", http.StatusMovedPermanently, "/manual/Intro"},
+		{"ignore case keeps remainder after folded runes", handy.RedirectOptions{IgnoreCase: true}, "/\u212A/\u212A-x", http.StatusMovedPermanently, "/m/%e2%84%aa-x"},
+		{"ignore trailing slash on request", handy.RedirectOptions{IgnoreTrailingSlash: true}, "/Pricing/", http.StatusMovedPermanently, "/plans"},
+		{"ignore trailing slash on source", handy.RedirectOptions{IgnoreTrailingSlash: true}, "/about", http.StatusMovedPermanently, "/company"},
+		{"ignore trailing slash root", handy.RedirectOptions{IgnoreTrailingSlash: true}, "/", http.StatusMovedPermanently, "/home"},
+		{"decode sources", handy.RedirectOptions{DecodeSources: true}, "/café", http.StatusMovedPermanently, "/coffee"},
+		{"collapse slashes", handy.RedirectOptions{CollapseSlashes: true}, "//docs///v1/intro", http.StatusMovedPermanently, "/manual/intro"},
+		{"everything", handy.RedirectOptions{
+			IgnoreCase:          true,
+			IgnoreTrailingSlash: true,
+			DecodeSources:       true,
+			CollapseSlashes:     true,
+		}, "//CAFÉ//", http.StatusMovedPermanently, "/coffee"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handy.ServeRedirects(redirects, tc.opts)
+			r := httptest.NewRequest("GET", "/", nil)
+			r.URL.Path = tc.path
+			r.Host = "example.com"
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.wantCode {
+				t.Fatalf("request for %q returned status %d, expected %d", tc.path, w.Code, tc.wantCode)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantURL {
+				t.Fatalf("request for %q redirected to %q, expected %q", tc.path, got, tc.wantURL)
+			}
+		})
+	}
+}
+
+func TestRedirectHandlerNormalizedSources(t *testing.T) {
+	opts := handy.RedirectOptions{IgnoreCase: true, IgnoreTrailingSlash: true}
+	if _, err := handy.NewRedirectHandler(map[string]handy.Redirect{
+		"/pricing":  {URL: "/plans"},
+		"/Pricing/": {URL: "/prices"},
+	}, opts); err == nil {
+		t.Fatalf("expected error for sources that are the same once normalized")
+	}
+	if _, err := handy.NewRedirectHandler(map[string]handy.Redirect{"/bad%zz": {URL: "/x"}}, handy.RedirectOptions{DecodeSources: true}); err == nil {
+		t.Fatalf("expected error for malformed percent encoding")
+	}
+
+	h := handy.ServeRedirects(nil, opts)
+	if err := h.Set("/Old/", handy.Redirect{URL: "/new"}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	if err := h.Set("/OLD", handy.Redirect{URL: "/newer"}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	if got, want := h.Snapshot(), map[string]handy.Redirect{"/old": {URL: "/newer"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("redirects %+v, expected %+v", got, want)
+	}
+	if err := h.Set("/newer/", handy.Redirect{URL: "/Old"}); err == nil {
+		t.Fatalf("expected error for loop through normalized paths")
+	}
+	h.Delete("/old/")
+	if got := h.Snapshot(); len(got) != 0 {
+		t.Fatalf("redirects %+v after delete, expected none", got)
+	}
+}
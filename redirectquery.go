@@ -0,0 +1,93 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// QueryPolicy controls what becomes of the query string of a redirected
+// request. Any fragment of the destination URL is always kept.
+type QueryPolicy int
+
+const (
+	// QueryDefault uses the handler's default policy, which is itself
+	// QueryDrop unless set in RedirectOptions.
+	QueryDefault QueryPolicy = iota
+
+	// QueryDrop discards the request query, redirecting to the
+	// destination URL as is.
+	QueryDrop
+
+	// QueryPass appends the request query, exactly as received, to any
+	// query of the destination URL.
+	QueryPass
+
+	// QueryMerge adds the request query parameters to the destination
+	// URL, keeping the destination's values for any parameter in both.
+	QueryMerge
+
+	// QueryOverride adds the request query parameters to the destination
+	// URL, replacing the destination's values for any parameter in both.
+	QueryOverride
+)
+
+var queryPolicyNames = []string{"", "drop", "pass", "merge", "override"}
+
+func (qp QueryPolicy) String() string {
+	if qp < 0 || int(qp) >= len(queryPolicyNames) {
+		return fmt.Sprintf("QueryPolicy(%d)", int(qp))
+	}
+	return queryPolicyNames[qp]
+}
+
+// MarshalText encodes the policy by name, as in "merge".
+func (qp QueryPolicy) MarshalText() ([]byte, error) {
+	if qp < 0 || int(qp) >= len(queryPolicyNames) {
+		return nil, fmt.Errorf("handy: invalid query policy %d", int(qp))
+	}
+	return []byte(queryPolicyNames[qp]), nil
+}
+
+// UnmarshalText decodes a policy encoded by MarshalText.
+func (qp *QueryPolicy) UnmarshalText(text []byte) error {
+	for i, name := range queryPolicyNames {
+		if string(text) == name {
+			*qp = QueryPolicy(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("handy: unknown query policy %q", text)
+}
+
+// applyQuery returns the destination URL with the request query applied
+// according to qp.
+func applyQuery(dest string, req *url.URL, qp QueryPolicy) string {
+	if qp == QueryDrop || qp == QueryDefault || req.RawQuery == "" {
+		return dest
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return dest
+	}
+	switch qp {
+	case QueryPass:
+		if u.RawQuery == "" {
+			u.RawQuery = req.RawQuery
+		} else {
+			u.RawQuery += "&" + req.RawQuery
+		}
+	case QueryMerge, QueryOverride:
+		query := u.Query()
+		for k, v := range req.Query() {
+			if _, ok := query[k]; ok && qp == QueryMerge {
+				continue
+			}
+			query[k] = v
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
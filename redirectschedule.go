@@ -0,0 +1,61 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// activeAt reports whether the redirect is scheduled at now, or is always
+// considered active if now is zero.
+func (rd Redirect) activeAt(now time.Time) bool {
+	if now.IsZero() {
+		return true
+	}
+	if !rd.NotBefore.IsZero() && now.Before(rd.NotBefore) {
+		return false
+	}
+	return rd.NotAfter.IsZero() || now.Before(rd.NotAfter)
+}
+
+// scheduled reports whether the redirect is limited to some time.
+func (rd Redirect) scheduled() bool {
+	return !rd.NotBefore.IsZero() || !rd.NotAfter.IsZero()
+}
+
+// redirectJSON is the JSON encoding of a Redirect, leaving out any times
+// that are not set, which omitempty does not do for a time.Time.
+type redirectJSON struct {
+	URL       string      `json:"url"`
+	Code      int         `json:"code,omitempty"`
+	Query     QueryPolicy `json:"query,omitempty"`
+	NotBefore *time.Time  `json:"not_before,omitempty"`
+	NotAfter  *time.Time  `json:"not_after,omitempty"`
+}
+
+func (rd Redirect) toJSON() redirectJSON {
+	v := redirectJSON{URL: rd.URL, Code: rd.Code, Query: rd.Query}
+	if !rd.NotBefore.IsZero() {
+		v.NotBefore = &rd.NotBefore
+	}
+	if !rd.NotAfter.IsZero() {
+		v.NotAfter = &rd.NotAfter
+	}
+	return v
+}
+
+// MarshalJSON encodes the redirect, leaving out any unset times.
+func (rd Redirect) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rd.toJSON())
+}
+
+// MarshalJSON encodes the redirect along with its pattern. Without it, the
+// method of the embedded Redirect would leave out the pattern.
+func (rr RegexpRedirect) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Pattern string `json:"pattern"`
+		redirectJSON
+	}{rr.Pattern, rr.Redirect.toJSON()})
+}
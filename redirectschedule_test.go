@@ -0,0 +1,212 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestServeRedirectsScheduled(t *testing.T) {
+	start := time.Date(2016, 11, 25, 0, 0, 0, 0, time.UTC)
+	end := start.Add(4 * 24 * time.Hour)
+	var (
+		mu  sync.Mutex
+		now time.Time
+	)
+	setNow := func(t time.Time) {
+		mu.Lock()
+		now = t
+		mu.Unlock()
+	}
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	h := handy.ServeRedirects(map[string]handy.Redirect{
+		"/sale":      {URL: "/black-friday", Code: 302, NotBefore: start, NotAfter: end},
+		"/sale*":     {URL: "/deals"},
+		"/beta":      {URL: "/new-beta", NotAfter: end},
+		"/launch":    {URL: "/product", NotBefore: end},
+		"/permanent": {URL: "/always"},
+	}, handy.RedirectOptions{
+		Clock: clock,
+		Regexps: []handy.RegexpRedirect{
+			{Pattern: "^/promo/", Redirect: handy.Redirect{URL: "/promotions", NotBefore: start, NotAfter: end}},
+		},
+	})
+
+	testCases := []struct {
+		name     string
+		now      time.Time
+		path     string
+		wantCode int
+		wantURL  string
+	}{
+		{"before window falls back to pattern", start.Add(-time.Second), "/sale", 301, "/deals"},
+		{"window start", start, "/sale", 302, "/black-friday"},
+		{"within window", start.Add(time.Hour), "/sale", 302, "/black-friday"},
+		{"window end", end, "/sale", 301, "/deals"},
+		{"before expiry", end.Add(-time.Nanosecond), "/beta", 301, "/new-beta"},
+		{"expired", end, "/beta", 404, ""},
+		{"not yet launched", start, "/launch", 404, ""},
+		{"launched", end.Add(time.Hour), "/launch", 301, "/product"},
+		{"unscheduled", start.Add(-time.Hour), "/permanent", 301, "/always"},
+		{"regexp within window", start, "/promo/x", 301, "/promotions"},
+		{"regexp outside window", end, "/promo/x", 404, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setNow(tc.now)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+			if w.Code != tc.wantCode {
+				t.Fatalf("status %d, expected %d", w.Code, tc.wantCode)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantURL {
+				t.Fatalf("redirected to %q, expected %q", got, tc.wantURL)
+			}
+		})
+	}
+
+	if err := h.Set("/bad", handy.Redirect{URL: "/x", NotBefore: end, NotAfter: start}); err == nil {
+		t.Fatalf("expected error for redirect that expires before it starts")
+	}
+	// loops are rejected even if their redirects are never active together
+	if err := h.Set("/new-beta", handy.Redirect{URL: "/beta", NotBefore: end}); err == nil {
+		t.Fatalf("expected error for scheduled redirect loop")
+	}
+}
+
+func TestServeRedirectsScheduledLater(t *testing.T) {
+	// a table with nothing scheduled must still keep to the schedule of a
+	// redirect set later, and of one replaced without a schedule no longer
+	start := time.Date(2016, 11, 25, 0, 0, 0, 0, time.UTC)
+	h := handy.ServeRedirects(map[string]handy.Redirect{"/a": {URL: "/b"}}, handy.RedirectOptions{
+		Clock: func() time.Time { return start },
+	})
+	lookup := func() string {
+		url, _, _ := h.Lookup(httptest.NewRequest("GET", "/sale", nil))
+		return url
+	}
+
+	if err := h.Set("/sale", handy.Redirect{URL: "/deals", NotBefore: start.Add(time.Hour)}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	if got := lookup(); got != "" {
+		t.Fatalf("request redirected to %q before the redirect starts", got)
+	}
+	if err := h.Set("/sale", handy.Redirect{URL: "/deals"}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	if got := lookup(); got != "/deals" {
+		t.Fatalf("request redirected to %q, expected %q", got, "/deals")
+	}
+	if err := h.SetRegexps([]handy.RegexpRedirect{{Pattern: "^/sale", Redirect: handy.Redirect{URL: "/later", NotBefore: start.Add(time.Hour)}}}); err != nil {
+		t.Fatalf("unexpected error setting regexps: %+v", err)
+	}
+	h.Delete("/sale")
+	if got := lookup(); got != "" {
+		t.Fatalf("request redirected to %q before the regexp starts", got)
+	}
+}
+
+func TestRedirectFlattenScheduled(t *testing.T) {
+	start := time.Date(2016, 11, 25, 0, 0, 0, 0, time.UTC)
+	now := start
+	h := handy.ServeRedirects(map[string]handy.Redirect{
+		"/a": {URL: "/b"},
+		"/b": {URL: "/c", NotAfter: start.Add(time.Hour)},
+		"/c": {URL: "/d"},
+		"/x": {URL: "/y", NotAfter: start.Add(time.Hour)},
+		"/y": {URL: "/z"},
+	}, handy.RedirectOptions{Flatten: true, Clock: func() time.Time { return now }})
+
+	testCases := []struct {
+		name    string
+		at      time.Time
+		path    string
+		wantURL string
+	}{
+		{"before expiry", start, "/a", "/b"},
+		{"after expiry", start.Add(2 * time.Hour), "/a", "/b"},
+		{"from scheduled source", start, "/x", "/z"},
+		{"from expired source", start.Add(2 * time.Hour), "/x", ""},
+		{"through expired redirect", start.Add(2 * time.Hour), "/b", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now = tc.at
+			url, _, _ := h.Lookup(httptest.NewRequest("GET", tc.path, nil))
+			if url != tc.wantURL {
+				t.Fatalf("request for %q redirected to %q, expected %q", tc.path, url, tc.wantURL)
+			}
+		})
+	}
+}
+
+func TestRedirectJSON(t *testing.T) {
+	start := time.Date(2016, 11, 25, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"plain", handy.Redirect{URL: "/new"}, `{"url":"/new"}`},
+		{"scheduled",
+			handy.Redirect{URL: "/new", Code: 302, NotBefore: start},
+			`{"url":"/new","code":302,"not_before":"2016-11-25T00:00:00Z"}`,
+		},
+		{"regexp",
+			handy.RegexpRedirect{Pattern: "^/a", Redirect: handy.Redirect{URL: "/b", Query: handy.QueryPass, NotAfter: start}},
+			`{"pattern":"^/a","url":"/b","query":"pass","not_after":"2016-11-25T00:00:00Z"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(tc.v)
+			if err != nil {
+				t.Fatalf("unexpected error encoding: %+v", err)
+			}
+			if string(b) != tc.want {
+				t.Fatalf("encoded %s, expected %s", b, tc.want)
+			}
+			decoded := reflect.New(reflect.TypeOf(tc.v))
+			if err := json.Unmarshal(b, decoded.Interface()); err != nil {
+				t.Fatalf("unexpected error decoding: %+v", err)
+			}
+			if got := decoded.Elem().Interface(); !reflect.DeepEqual(got, tc.v) {
+				t.Fatalf("decoded %+v, expected %+v", got, tc.v)
+			}
+		})
+	}
+
+	redirects, err := handy.ParseRedirects([]byte(`/sale:
+  url: /black-friday
+  not_before: 2016-11-25T00:00:00Z
+  not_after: "2016-11-29T00:00:00Z"
+`), "yaml")
+	if err != nil {
+		t.Fatalf("unexpected error parsing YAML: %+v", err)
+	}
+	want := map[string]handy.Redirect{"/sale": {URL: "/black-friday", NotBefore: start, NotAfter: start.Add(4 * 24 * time.Hour)}}
+	if !reflect.DeepEqual(redirects, want) {
+		t.Fatalf("parsed %+v, expected %+v", redirects, want)
+	}
+	if _, err := handy.ParseRedirects([]byte("/sale:\n  url: /x\n  not_after: friday\n"), "yaml"); err == nil {
+		t.Fatalf("expected error for invalid time")
+	}
+}
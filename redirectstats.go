@@ -0,0 +1,164 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedirectStat describes the requests redirected by a single rule.
+type RedirectStat struct {
+	// Rule is the source of the redirect, or ~ followed by the pattern
+	// of a RegexpRedirect.
+	Rule string `json:"rule"`
+
+	Hits    int64     `json:"hits"`
+	LastHit time.Time `json:"last_hit"`
+
+	// Referrers and UserAgents are a random sample of those sent with
+	// the requests redirected.
+	Referrers  []string `json:"referrers"`
+	UserAgents []string `json:"user_agents"`
+}
+
+// redirectStats counts the requests redirected by each rule.
+type redirectStats struct {
+	mu      sync.Mutex
+	samples int
+	rules   map[string]*RedirectStat
+	rand    *rand.Rand
+}
+
+func newRedirectStats(samples int) *redirectStats {
+	return &redirectStats{
+		samples: samples,
+		rules:   make(map[string]*RedirectStat),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (rs *redirectStats) record(rule string, r *http.Request, now time.Time) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	stat, ok := rs.rules[rule]
+	if !ok {
+		stat = &RedirectStat{Rule: rule}
+		rs.rules[rule] = stat
+	}
+	stat.Hits++
+	stat.LastHit = now
+	if rs.samples <= 0 {
+		return
+	}
+	// reservoir sampling keeps each request equally likely to be sampled
+	i := int(stat.Hits - 1)
+	if i >= rs.samples {
+		i = int(rs.rand.Int63n(stat.Hits))
+	}
+	if i < len(stat.Referrers) {
+		stat.Referrers[i] = r.Referer()
+		stat.UserAgents[i] = r.UserAgent()
+	} else if i < rs.samples {
+		stat.Referrers = append(stat.Referrers, r.Referer())
+		stat.UserAgents = append(stat.UserAgents, r.UserAgent())
+	}
+}
+
+func (rs *redirectStats) reset() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.rules = make(map[string]*RedirectStat)
+}
+
+// Stats returns the statistics for every current rule, including those
+// that have never been used, ordered by rule. It returns nil unless the
+// handler was created with RedirectOptions.Stats set.
+func (h *RedirectHandler) Stats() []RedirectStat {
+	if h.stats == nil {
+		return nil
+	}
+	h.mu.RLock()
+	rules := make([]string, 0, len(h.rules.redirects)+len(h.rules.regexps.list))
+	for from := range h.rules.redirects {
+		rules = append(rules, from)
+	}
+	for _, rr := range h.rules.regexps.list {
+		rules = append(rules, rr.rule)
+	}
+	h.mu.RUnlock()
+	sort.Strings(rules)
+
+	h.stats.mu.Lock()
+	defer h.stats.mu.Unlock()
+	stats := make([]RedirectStat, len(rules))
+	for i, rule := range rules {
+		stats[i].Rule = rule
+		if stat, ok := h.stats.rules[rule]; ok {
+			stats[i] = *stat
+			stats[i].Referrers = append([]string(nil), stat.Referrers...)
+			stats[i].UserAgents = append([]string(nil), stat.UserAgents...)
+		}
+	}
+	return stats
+}
+
+// ResetStats discards all statistics.
+func (h *RedirectHandler) ResetStats() {
+	if h.stats != nil {
+		h.stats.reset()
+	}
+}
+
+// StatsHandler provides an http.Handler that responds to GET with the
+// statistics as JSON, or as CSV if the format=csv query parameter is given,
+// and to DELETE by resetting them.
+func (h *RedirectHandler) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodDelete:
+			h.ResetStats()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			w.Header().Set("Allow", "GET, HEAD, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		stats := h.Stats()
+		if r.URL.Query().Get("format") != "csv" {
+			if stats == nil {
+				stats = []RedirectStat{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(stats)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"rule", "hits", "last_hit", "referrers", "user_agents"})
+		for _, stat := range stats {
+			var lastHit string
+			if !stat.LastHit.IsZero() {
+				lastHit = stat.LastHit.Format(time.RFC3339)
+			}
+			cw.Write([]string{
+				stat.Rule,
+				strconv.FormatInt(stat.Hits, 10),
+				lastHit,
+				strings.Join(stat.Referrers, "\n"),
+				strings.Join(stat.UserAgents, "\n"),
+			})
+		}
+		cw.Flush()
+	})
+}
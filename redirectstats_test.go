@@ -0,0 +1,108 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestRedirectHandlerStats(t *testing.T) {
+	h := handy.ServeRedirects(map[string]handy.Redirect{
+		"/old":   {URL: "/new"},
+		"/docs*": {URL: "/manual*"},
+		"/gone":  {URL: "/away"},
+	}, handy.RedirectOptions{
+		Stats:   true,
+		Samples: 2,
+		Regexps: []handy.RegexpRedirect{{Pattern: `^/u/(\d+)$`, Redirect: handy.Redirect{URL: "/users/$1"}}},
+	})
+
+	get := func(path, referrer, agent string) {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Referer", referrer)
+		r.Header.Set("User-Agent", agent)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	for i := 0; i < 5; i++ {
+		get("/old", "http://example.com/", "agent")
+	}
+	get("/docs/intro", "", "")
+	get("/u/42", "", "")
+	get("/missing", "", "")
+
+	stats := h.Stats()
+	want := []struct {
+		rule string
+		hits int64
+	}{{"/docs*", 1}, {"/gone", 0}, {"/old", 5}, {`~^/u/(\d+)$`, 1}}
+	if len(stats) != len(want) {
+		t.Fatalf("stats %+v, expected %d rules", stats, len(want))
+	}
+	for i, w := range want {
+		if stats[i].Rule != w.rule || stats[i].Hits != w.hits {
+			t.Fatalf("stats[%d] %+v, expected rule %q with %d hits", i, stats[i], w.rule, w.hits)
+		}
+		if stats[i].LastHit.IsZero() != (w.hits == 0) {
+			t.Fatalf("stats[%d] last hit %v with %d hits", i, stats[i].LastHit, w.hits)
+		}
+	}
+	if old := stats[2]; len(old.Referrers) != 2 || old.Referrers[0] != "http://example.com/" || old.UserAgents[1] != "agent" {
+		t.Fatalf("sampled referrers %q and user agents %q, expected 2 of each", old.Referrers, old.UserAgents)
+	}
+
+	s := httptest.NewServer(h.StatsHandler())
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("unexpected error getting stats: %+v", err)
+	}
+	var got []handy.RedirectStat
+	err = json.NewDecoder(res.Body).Decode(&got)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("unexpected error decoding stats: %+v", err)
+	}
+	if len(got) != len(want) || got[2].Hits != 5 {
+		t.Fatalf("JSON stats %+v, expected %+v", got, stats)
+	}
+
+	res, err = http.Get(s.URL + "?format=csv")
+	if err != nil {
+		t.Fatalf("unexpected error getting stats: %+v", err)
+	}
+	records, err := csv.NewReader(res.Body).ReadAll()
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("unexpected error reading CSV stats: %+v", err)
+	}
+	if len(records) != len(want)+1 || records[0][0] != "rule" || records[3][0] != "/old" || records[3][1] != "5" {
+		t.Fatalf("CSV stats %q", records)
+	}
+
+	req, _ := http.NewRequest("DELETE", s.URL, nil)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error resetting stats: %+v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("reset status %d, expected %d", res.StatusCode, http.StatusNoContent)
+	}
+	for _, stat := range h.Stats() {
+		if stat.Hits != 0 {
+			t.Fatalf("stat %+v after reset, expected no hits", stat)
+		}
+	}
+
+	if stats := handy.ServeRedirects(map[string]handy.Redirect{"/a": {URL: "/b"}}, handy.RedirectOptions{}).Stats(); stats != nil {
+		t.Fatalf("stats %+v, expected nil when disabled", stats)
+	}
+}
@@ -0,0 +1,213 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RedirectStore persists a redirect table, so that changes made while
+// serving survive a restart. Sources are given in canonical form, with the
+// host lowercased. A store must be safe for concurrent use, and must not
+// keep the maps it is given.
+type RedirectStore interface {
+	// Load returns the stored redirects.
+	Load() (map[string]Redirect, error)
+
+	// Set stores the redirect for from.
+	Set(from string, to Redirect) error
+
+	// Delete removes the redirect for from, if any.
+	Delete(from string) error
+
+	// Replace stores redirects in place of the whole table.
+	Replace(redirects map[string]Redirect) error
+}
+
+// MemoryRedirectStore is a RedirectStore that keeps the table in memory,
+// which is what a RedirectHandler does without a store. It is mostly useful
+// for sharing a table between handlers, and for testing.
+type MemoryRedirectStore struct {
+	mu        sync.Mutex
+	redirects map[string]Redirect
+}
+
+// NewMemoryRedirectStore provides a MemoryRedirectStore holding a copy of
+// redirects.
+func NewMemoryRedirectStore(redirects map[string]Redirect) *MemoryRedirectStore {
+	return &MemoryRedirectStore{redirects: copyRedirects(redirects)}
+}
+
+// Load returns a copy of the stored redirects.
+func (s *MemoryRedirectStore) Load() (map[string]Redirect, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyRedirects(s.redirects), nil
+}
+
+// Set stores the redirect for from.
+func (s *MemoryRedirectStore) Set(from string, to Redirect) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.redirects == nil {
+		s.redirects = make(map[string]Redirect)
+	}
+	s.redirects[from] = to
+	return nil
+}
+
+// Delete removes the redirect for from.
+func (s *MemoryRedirectStore) Delete(from string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.redirects, from)
+	return nil
+}
+
+// Replace stores a copy of redirects in place of the whole table.
+func (s *MemoryRedirectStore) Replace(redirects map[string]Redirect) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.redirects = copyRedirects(redirects)
+	return nil
+}
+
+// FileRedirectStore is a RedirectStore that keeps the table in a JSON file,
+// as read by LoadRedirects, rewriting it in full on every change. It suits
+// tables that change rarely; the file should not also be watched with
+// WatchFile.
+type FileRedirectStore struct {
+	mu        sync.Mutex
+	filename  string
+	redirects map[string]Redirect
+}
+
+// OpenFileRedirectStore provides a FileRedirectStore for filename, which is
+// created on the first change if it does not exist.
+func OpenFileRedirectStore(filename string) (*FileRedirectStore, error) {
+	redirects := make(map[string]Redirect)
+	if _, err := os.Stat(filename); err == nil {
+		if redirects, err = LoadRedirects(filename); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &FileRedirectStore{filename: filename, redirects: redirects}, nil
+}
+
+// Load returns the redirects read from the file when it was opened, along
+// with any changes since.
+func (s *FileRedirectStore) Load() (map[string]Redirect, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyRedirects(s.redirects), nil
+}
+
+// Set stores the redirect for from.
+func (s *FileRedirectStore) Set(from string, to Redirect) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	redirects := copyRedirects(s.redirects)
+	redirects[from] = to
+	return s.write(redirects)
+}
+
+// Delete removes the redirect for from.
+func (s *FileRedirectStore) Delete(from string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.redirects[from]; !ok {
+		return nil
+	}
+	redirects := copyRedirects(s.redirects)
+	delete(redirects, from)
+	return s.write(redirects)
+}
+
+// Replace stores redirects in place of the whole table.
+func (s *FileRedirectStore) Replace(redirects map[string]Redirect) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(copyRedirects(redirects))
+}
+
+// write saves redirects to the file, keeping them only if that succeeds.
+func (s *FileRedirectStore) write(redirects map[string]Redirect) error {
+	data, err := json.MarshalIndent(redirects, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.filename, append(data, '\n')); err != nil {
+		return err
+	}
+	s.redirects = redirects
+	return nil
+}
+
+// writeFileAtomic replaces filename with data, so that readers see either
+// the old or the new content, even after a crash.
+func writeFileAtomic(filename string, data []byte) error {
+	f, err := writeTempFile(filename, data)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return syncDir(filename)
+}
+
+// syncDir syncs the directory holding filename, so that a file just renamed
+// to filename is still there after a crash.
+func syncDir(filename string) error {
+	dir, err := os.Open(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if cerr := dir.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeTempFile writes data to a new file beside filename, synced and
+// readable by all, and returns it still open for writing at its end.
+func writeTempFile(filename string, data []byte) (*os.File, error) {
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+func copyRedirects(redirects map[string]Redirect) map[string]Redirect {
+	table := make(map[string]Redirect, len(redirects))
+	for from, to := range redirects {
+		table[from] = to
+	}
+	return table
+}
@@ -0,0 +1,250 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestRedirectStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handy")
+	if err != nil {
+		t.Fatalf("creating temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name string
+		open func() (handy.RedirectStore, error)
+	}{
+		{"memory", func() (handy.RedirectStore, error) {
+			return handy.NewMemoryRedirectStore(nil), nil
+		}},
+		{"file", func() (handy.RedirectStore, error) {
+			return handy.OpenFileRedirectStore(filepath.Join(dir, "redirects.json"))
+		}},
+		{"log", func() (handy.RedirectStore, error) {
+			return handy.OpenLogRedirectStore(filepath.Join(dir, "redirects.log"))
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := tc.open()
+			if err != nil {
+				t.Fatalf("unexpected error opening store: %+v", err)
+			}
+			check := func(store handy.RedirectStore, want map[string]handy.Redirect) {
+				got, err := store.Load()
+				if err != nil {
+					t.Fatalf("unexpected error loading redirects: %+v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("loaded %+v, expected %+v", got, want)
+				}
+			}
+			check(store, map[string]handy.Redirect{})
+
+			table := map[string]handy.Redirect{"/a": {URL: "/b"}, "/c": {URL: "/d", Code: 307}}
+			if err := store.Replace(table); err != nil {
+				t.Fatalf("unexpected error replacing redirects: %+v", err)
+			}
+			table["/e"] = handy.Redirect{URL: "/f"} // the store must keep a copy
+			if err := store.Set("/g", handy.Redirect{URL: "/h", Query: handy.QueryPass}); err != nil {
+				t.Fatalf("unexpected error setting redirect: %+v", err)
+			}
+			if err := store.Delete("/a"); err != nil {
+				t.Fatalf("unexpected error deleting redirect: %+v", err)
+			}
+			if err := store.Delete("/missing"); err != nil {
+				t.Fatalf("unexpected error deleting missing redirect: %+v", err)
+			}
+			want := map[string]handy.Redirect{"/c": {URL: "/d", Code: 307}, "/g": {URL: "/h", Query: handy.QueryPass}}
+			check(store, want)
+
+			if tc.name == "memory" {
+				return
+			}
+			// many changes force the log to be compacted along the way
+			for i := 0; i < 200; i++ {
+				if err := store.Set("/x", handy.Redirect{URL: fmt.Sprintf("/%d", i)}); err != nil {
+					t.Fatalf("unexpected error setting redirect: %+v", err)
+				}
+			}
+			want["/x"] = handy.Redirect{URL: "/199"}
+			if log, ok := store.(*handy.LogRedirectStore); ok {
+				if err := log.Close(); err != nil {
+					t.Fatalf("unexpected error closing store: %+v", err)
+				}
+			}
+			reopened, err := tc.open()
+			if err != nil {
+				t.Fatalf("unexpected error reopening store: %+v", err)
+			}
+			check(reopened, want)
+			if log, ok := reopened.(*handy.LogRedirectStore); ok {
+				log.Close()
+			}
+		})
+	}
+}
+
+func TestLogRedirectStoreRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handy")
+	if err != nil {
+		t.Fatalf("creating temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "redirects.log")
+
+	data := `{"from":"/a","to":{"url":"/b"}}
+{"from":"/c","to":{"url":"/d"}}
+{"from":"/a"}
+{"from":"/e","to":{"u`
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatalf("writing log: %+v", err)
+	}
+	store, err := handy.OpenLogRedirectStore(filename)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %+v", err)
+	}
+	if err := store.Set("/f", handy.Redirect{URL: "/g"}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	store.Close()
+	if err := store.Set("/h", handy.Redirect{URL: "/i"}); err == nil {
+		t.Fatalf("expected error using closed store")
+	}
+
+	store, err = handy.OpenLogRedirectStore(filename)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %+v", err)
+	}
+	defer store.Close()
+	got, _ := store.Load()
+	if want := map[string]handy.Redirect{"/c": {URL: "/d"}, "/f": {URL: "/g"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("recovered %+v, expected %+v", got, want)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("not json\n{}\n"), 0644); err != nil {
+		t.Fatalf("writing log: %+v", err)
+	}
+	if _, err := handy.OpenLogRedirectStore(filename); err == nil {
+		t.Fatalf("expected error opening corrupt log")
+	}
+}
+
+func TestRedirectHandlerStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handy")
+	if err != nil {
+		t.Fatalf("creating temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "redirects.json")
+
+	store, err := handy.OpenFileRedirectStore(filename)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %+v", err)
+	}
+	h := handy.ServeRedirects(map[string]handy.Redirect{"/seed": {URL: "/a"}}, handy.RedirectOptions{Store: store, Flatten: true})
+	if err := h.Set("/a", handy.Redirect{URL: "/b"}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	if err := h.Set("/b", handy.Redirect{URL: "/seed"}); err == nil {
+		t.Fatalf("expected error setting redirect loop")
+	}
+	if err := h.Set("Example.com/old", handy.Redirect{URL: "/new"}); err != nil {
+		t.Fatalf("unexpected error setting redirect: %+v", err)
+	}
+	h.Delete("example.com/old")
+
+	// the store keeps the redirects as given, without flattening
+	want := map[string]handy.Redirect{"/seed": {URL: "/a"}, "/a": {URL: "/b"}}
+	if got, _ := store.Load(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored %+v, expected %+v", got, want)
+	}
+
+	// a restarted handler ignores its seed in favour of the stored table
+	store, err = handy.OpenFileRedirectStore(filename)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %+v", err)
+	}
+	h = handy.ServeRedirects(map[string]handy.Redirect{"/other": {URL: "/x"}}, handy.RedirectOptions{Store: store, Flatten: true})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/seed", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/b" {
+		t.Fatalf("redirected with %d to %q, expected flattened redirect to /b", w.Code, w.Header().Get("Location"))
+	}
+	if got := h.Snapshot(); len(got) != 2 {
+		t.Fatalf("loaded %+v, expected stored redirects", got)
+	}
+
+	// changes that cannot be stored are not made
+	os.RemoveAll(dir)
+	if err := h.Set("/c", handy.Redirect{URL: "/d"}); err == nil {
+		t.Fatalf("expected error storing redirect")
+	}
+	if err := h.Replace(nil); err == nil {
+		t.Fatalf("expected error storing redirects")
+	}
+	if got := h.Snapshot(); len(got) != 2 {
+		t.Fatalf("redirects %+v after failed changes, expected them unchanged", got)
+	}
+}
+
+func TestLogRedirectStoreCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handy")
+	if err != nil {
+		t.Fatalf("creating temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "redirects.log")
+
+	store, err := handy.OpenLogRedirectStore(filename)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %+v", err)
+	}
+	defer store.Close()
+	for i := 0; i < 200; i++ {
+		if err := store.Set("/a", handy.Redirect{URL: fmt.Sprintf("/%d", i)}); err != nil {
+			t.Fatalf("unexpected error setting redirect: %+v", err)
+		}
+	}
+	data, _ := ioutil.ReadFile(filename)
+	if lines := bytes.Count(data, []byte("\n")); lines > 100 {
+		t.Fatalf("log has %d records for one redirect, expected it compacted", lines)
+	}
+	reopened, err := handy.OpenLogRedirectStore(filename)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %+v", err)
+	}
+	got, _ := reopened.Load()
+	reopened.Close()
+	if want := map[string]handy.Redirect{"/a": {URL: "/199"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("reopened %+v, expected %+v", got, want)
+	}
+
+	// a change that needs the log compacted, but cannot be, is not made
+	os.RemoveAll(dir)
+	for i := 0; i <= 100; i++ {
+		url := fmt.Sprintf("/failed/%d", i)
+		if err := store.Set("/a", handy.Redirect{URL: url}); err != nil {
+			if got, _ := store.Load(); got["/a"].URL == url {
+				t.Fatalf("store has %+v after failed change", got)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected error compacting log in a removed directory")
+}
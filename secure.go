@@ -0,0 +1,282 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecurePolicy is how SecureMiddleware treats requests for a host.
+type SecurePolicy struct {
+	// AllowHTTP serves plain HTTP requests rather than redirecting them to
+	// HTTPS.
+	AllowHTTP bool
+
+	// CanonicalHost, if set, is the host that requests for any other are
+	// redirected to. It may include a port.
+	CanonicalHost string
+
+	// HSTSMaxAge, if positive, adds a Strict-Transport-Security header
+	// to responses sent over HTTPS, asking browsers to use only HTTPS
+	// for the host for that long.
+	HSTSMaxAge time.Duration
+
+	// HSTSIncludeSubdomains and HSTSPreload add the includeSubDomains
+	// and preload directives to the Strict-Transport-Security header.
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// Exclude lists paths served just as they are requested, without
+	// redirects or headers, such as ACME challenges that must be served
+	// over HTTP. They may be patterns as in ServeRedirects
+	//
+	//	Exclude: []string{"/.well-known/acme-challenge/*"}
+	Exclude []string
+}
+
+// SecureOptions configures the handler returned by SecureMiddleware.
+type SecureOptions struct {
+	// SecurePolicy applies to any host without one in Hosts.
+	SecurePolicy
+
+	// Hosts holds the policy for particular hosts, which may be
+	// wildcards such as *.example.com, matched as in ServeRedirects.
+	Hosts map[string]SecurePolicy
+
+	// TrustedProxies are the addresses, or CIDR ranges, of proxies whose
+	// X-Forwarded-Proto header tells the scheme of a request. The header
+	// is ignored from any other client, and only the values added by
+	// trusted proxies, as traced back through X-Forwarded-For, are used.
+	TrustedProxies []string
+
+	// Code is the redirect status code. If zero, 301 Moved Permanently
+	// is used.
+	Code int
+}
+
+// SecureHandler is an http.Handler that redirects requests to HTTPS and to
+// canonical hosts, and adds HSTS headers, before passing them on.
+type SecureHandler struct {
+	def     securePolicy
+	hosts   map[string]securePolicy
+	proxies []*net.IPNet
+	code    int
+	next    http.Handler
+}
+
+// securePolicy is a validated SecurePolicy.
+type securePolicy struct {
+	SecurePolicy
+	hsts    string
+	exclude []redirectPattern
+}
+
+// SecureMiddleware provides a SecureHandler that redirects any plain HTTP
+// request to HTTPS, and any request for a host other than the canonical
+// host to that host, then passes the rest on to next. Both are done with a
+// single redirect, keeping the path and query.
+//
+// SecureMiddleware panics if any option is invalid.
+func SecureMiddleware(opts SecureOptions, next http.Handler) *SecureHandler {
+	h, err := NewSecureHandler(opts, next)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// NewSecureHandler is like SecureMiddleware, but returns an error rather
+// than panicking when given invalid options.
+func NewSecureHandler(opts SecureOptions, next http.Handler) (*SecureHandler, error) {
+	code := opts.Code
+	if code == 0 {
+		code = http.StatusMovedPermanently
+	}
+	if !isRedirectCode(code) {
+		return nil, fmt.Errorf("handy: invalid redirect code %d", code)
+	}
+	if next == nil {
+		next = http.NotFoundHandler()
+	}
+	h := &SecureHandler{code: code, next: next, hosts: make(map[string]securePolicy, len(opts.Hosts))}
+	var err error
+	if h.def, err = newSecurePolicy(opts.SecurePolicy); err != nil {
+		return nil, err
+	}
+	for host, policy := range opts.Hosts {
+		if host == "" || strings.ContainsAny(host, "/:") || strings.Contains(host[1:], "*") || (host[0] == '*' && !strings.HasPrefix(host, "*.")) {
+			return nil, fmt.Errorf("handy: invalid host %q", host)
+		}
+		if h.hosts[strings.ToLower(host)], err = newSecurePolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+	for _, proxy := range opts.TrustedProxies {
+		cidr := proxy
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("handy: invalid trusted proxy %q", proxy)
+		}
+		h.proxies = append(h.proxies, ipNet)
+	}
+	return h, nil
+}
+
+func newSecurePolicy(policy SecurePolicy) (securePolicy, error) {
+	sp := securePolicy{SecurePolicy: policy}
+	if policy.CanonicalHost != "" {
+		if strings.ContainsAny(policy.CanonicalHost, "/*") {
+			return sp, fmt.Errorf("handy: invalid canonical host %q", policy.CanonicalHost)
+		}
+		sp.CanonicalHost = strings.ToLower(policy.CanonicalHost)
+	}
+	if policy.HSTSMaxAge > 0 {
+		sp.hsts = "max-age=" + strconv.FormatInt(int64(policy.HSTSMaxAge/time.Second), 10)
+		if policy.HSTSIncludeSubdomains {
+			sp.hsts += "; includeSubDomains"
+		}
+		if policy.HSTSPreload {
+			sp.hsts += "; preload"
+		}
+	}
+	for _, from := range policy.Exclude {
+		if !strings.HasPrefix(from, "/") {
+			return sp, fmt.Errorf("handy: excluded path %q must start with /", from)
+		}
+		p, err := newRedirectPattern(from, Redirect{})
+		if err != nil {
+			return sp, err
+		}
+		sp.exclude = append(sp.exclude, p)
+	}
+	return sp, nil
+}
+
+// excludes reports whether urlPath is excluded from the policy.
+func (sp securePolicy) excludes(urlPath string) bool {
+	for _, p := range sp.exclude {
+		if !isRedirectPattern(p.from) {
+			if p.from == urlPath {
+				return true
+			}
+		} else if _, ok := p.match("", urlPath, urlPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// policy returns the policy for host, preferring an exact match, then the
+// most specific wildcard.
+func (h *SecureHandler) policy(host string) securePolicy {
+	if sp, ok := h.hosts[host]; ok {
+		return sp
+	}
+	for i := 0; i < len(host); i++ {
+		if host[i] == '.' {
+			if sp, ok := h.hosts["*"+host[i:]]; ok {
+				return sp
+			}
+		}
+	}
+	return h.def
+}
+
+// isHTTPS reports whether r was made over HTTPS, either directly or, as
+// told by X-Forwarded-Proto, to a trusted proxy. Each proxy appends the
+// protocol it was sent, so the list is read from the right, through as many
+// trusted proxies as X-Forwarded-For shows, and anything further left, which
+// the client may have sent, is ignored.
+func (h *SecureHandler) isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	protos := forwardedList(r.Header, "X-Forwarded-Proto")
+	addrs := forwardedList(r.Header, "X-Forwarded-For")
+	peer := r.RemoteAddr
+	proto := ""
+	for i := len(protos) - 1; i >= 0 && h.trusted(peer); i-- {
+		proto = protos[i]
+		// the proxy was sent the request by the last address it added
+		j := len(addrs) - (len(protos) - i)
+		if j < 0 {
+			break
+		}
+		peer = addrs[j]
+	}
+	return strings.EqualFold(proto, "https")
+}
+
+// forwardedList returns the comma separated values of the header name, in
+// order, from all of its lines.
+func forwardedList(header http.Header, name string) []string {
+	var list []string
+	for _, line := range header[http.CanonicalHeaderKey(name)] {
+		for _, v := range strings.Split(line, ",") {
+			list = append(list, strings.TrimSpace(v))
+		}
+	}
+	return list
+}
+
+// trusted reports whether remoteAddr is that of a trusted proxy.
+func (h *SecureHandler) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range h.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP redirects r, or passes it on, as the policy for its host says.
+func (h *SecureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := requestHost(r)
+	sp := h.policy(host)
+	if sp.excludes(r.URL.Path) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	https := h.isHTTPS(r)
+	if https && sp.hsts != "" {
+		w.Header().Set("Strict-Transport-Security", sp.hsts)
+	}
+	scheme, target, redirect := "https", r.Host, false
+	if !https {
+		if sp.AllowHTTP {
+			scheme = "http"
+		} else {
+			// the port serving plain HTTP would not serve HTTPS
+			target, redirect = host, true
+		}
+	}
+	if sp.CanonicalHost != "" && host != sp.CanonicalHost && !strings.EqualFold(r.Host, sp.CanonicalHost) {
+		target, redirect = sp.CanonicalHost, true
+	}
+	if redirect {
+		http.Redirect(w, r, scheme+"://"+target+r.URL.RequestURI(), h.code)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
@@ -0,0 +1,119 @@
+// © Copyright 2016 Jesse Allen. All rights reserved.
+// Released under the MIT license found in the LICENSE file.
+
+package handy_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jessecarl/handy"
+)
+
+func TestSecureMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := handy.SecureMiddleware(handy.SecureOptions{
+		SecurePolicy: handy.SecurePolicy{
+			CanonicalHost: "example.com",
+			HSTSMaxAge:    365 * 24 * time.Hour,
+			HSTSPreload:   true,
+			Exclude:       []string{"/.well-known/acme-challenge/*", "/healthz"},
+		},
+		Hosts: map[string]handy.SecurePolicy{
+			"dev.example.com":    {AllowHTTP: true},
+			"*.shop.example.com": {CanonicalHost: "shop.example.com", HSTSMaxAge: time.Hour, HSTSIncludeSubdomains: true},
+		},
+		TrustedProxies: []string{"10.0.0.0/8", "::1"},
+	}, ok)
+
+	testCases := []struct {
+		name         string
+		url          string
+		tls          bool
+		remoteAddr   string
+		forwarded    string
+		forwardedFor string
+		wantCode     int
+		wantLocation string
+		wantHSTS     string
+	}{
+		{"http to https", "http://example.com/a?b=c", false, "", "", "", http.StatusMovedPermanently, "https://example.com/a?b=c", ""},
+		{"http drops port", "http://example.com:8080/a", false, "", "", "", http.StatusMovedPermanently, "https://example.com/a", ""},
+		{"https served", "https://example.com/a", true, "", "", "", http.StatusOK, "", "max-age=31536000; preload"},
+		{"https keeps port", "https://example.com:8443/a", true, "", "", "", http.StatusOK, "", "max-age=31536000; preload"},
+		{"canonical host", "https://www.example.com/a", true, "", "", "", http.StatusMovedPermanently, "https://example.com/a", "max-age=31536000; preload"},
+		{"canonical host and https at once", "http://WWW.example.com/a", false, "", "", "", http.StatusMovedPermanently, "https://example.com/a", ""},
+		{"trusted proxy", "http://example.com/a", false, "10.1.2.3:1234", "https", "", http.StatusOK, "", "max-age=31536000; preload"},
+		{"spoofed before trusted proxy", "http://example.com/a", false, "[::1]:1234", "HTTPS, http", "", http.StatusMovedPermanently, "https://example.com/a", ""},
+		{"spoofed with forwarded for", "http://example.com/a", false, "10.1.2.3:1234", "https, http", "10.0.0.5, 192.0.2.9", http.StatusMovedPermanently, "https://example.com/a", ""},
+		{"trusted proxy chain", "http://example.com/a", false, "10.1.2.3:1234", "https, http", "192.0.2.9, 10.0.0.5", http.StatusOK, "", "max-age=31536000; preload"},
+		{"untrusted proxy in chain", "http://example.com/a", false, "10.1.2.3:1234", "http, https", "192.0.2.9, 192.0.2.10", http.StatusOK, "", "max-age=31536000; preload"},
+		{"trusted proxy over http", "http://example.com/a", false, "10.1.2.3:1234", "http", "", http.StatusMovedPermanently, "https://example.com/a", ""},
+		{"untrusted proxy", "http://example.com/a", false, "192.0.2.1:1234", "https", "", http.StatusMovedPermanently, "https://example.com/a", ""},
+		{"excluded prefix", "http://www.example.com/.well-known/acme-challenge/token", false, "", "", "", http.StatusOK, "", ""},
+		{"excluded path", "http://example.com/healthz", false, "", "", "", http.StatusOK, "", ""},
+		{"excluded path only", "http://example.com/healthz/x", false, "", "", "", http.StatusMovedPermanently, "https://example.com/healthz/x", ""},
+		{"host allows http", "http://dev.example.com/a", false, "", "", "", http.StatusOK, "", ""},
+		{"wildcard host", "http://eu.shop.example.com/a", false, "", "", "", http.StatusMovedPermanently, "https://shop.example.com/a", ""},
+		{"wildcard host hsts", "https://eu.shop.example.com/a", true, "", "", "", http.StatusMovedPermanently, "https://shop.example.com/a", "max-age=3600; includeSubDomains"},
+		{"wildcard host has no exclusions", "http://eu.shop.example.com/healthz", false, "", "", "", http.StatusMovedPermanently, "https://shop.example.com/healthz", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tc.url, nil)
+			if !tc.tls {
+				r.TLS = nil
+			} else if r.TLS == nil {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tc.remoteAddr != "" {
+				r.RemoteAddr = tc.remoteAddr
+			}
+			if tc.forwarded != "" {
+				r.Header.Set("X-Forwarded-Proto", tc.forwarded)
+			}
+			if tc.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.wantCode {
+				t.Fatalf("request returned status %d, expected %d", w.Code, tc.wantCode)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantLocation {
+				t.Fatalf("request redirected to %q, expected %q", got, tc.wantLocation)
+			}
+			if got := w.Header().Get("Strict-Transport-Security"); got != tc.wantHSTS {
+				t.Fatalf("request got HSTS header %q, expected %q", got, tc.wantHSTS)
+			}
+		})
+	}
+}
+
+func TestNewSecureHandler(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts handy.SecureOptions
+	}{
+		{"code", handy.SecureOptions{Code: http.StatusOK}},
+		{"canonical host", handy.SecureOptions{SecurePolicy: handy.SecurePolicy{CanonicalHost: "example.com/"}}},
+		{"exclude", handy.SecureOptions{SecurePolicy: handy.SecurePolicy{Exclude: []string{"healthz"}}}},
+		{"exclude pattern", handy.SecureOptions{SecurePolicy: handy.SecurePolicy{Exclude: []string{"/[a"}}}},
+		{"host", handy.SecureOptions{Hosts: map[string]handy.SecurePolicy{"www.*.com": {}}}},
+		{"proxy", handy.SecureOptions{TrustedProxies: []string{"proxy.local"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := handy.NewSecureHandler(tc.opts, nil); err == nil {
+				t.Fatalf("expected error for invalid options")
+			}
+		})
+	}
+}
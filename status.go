@@ -9,52 +9,242 @@ import (
 	"strings"
 )
 
+// StatusRange is an inclusive range of http status codes.
+type StatusRange struct {
+	From, To int
+}
+
+// StatusCode is a StatusRange containing only code.
+func StatusCode(code int) StatusRange {
+	return StatusRange{code, code}
+}
+
+func (sr StatusRange) contains(code int) bool {
+	return code >= sr.From && code <= sr.To
+}
+
+// StatusOptions configures the handler returned by ServeStatusWithOptions.
+// The zero value behaves the same as ServeStatus.
+type StatusOptions struct {
+	// Allow lists the only status codes that may be served. Codes listed
+	// here are served even if they are not otherwise supported, so long
+	// as they fall between 200 and 999; a 1xx response would only be
+	// followed by another. When Allow is empty, the codes supported by
+	// ServeStatus are allowed.
+	Allow []StatusRange
+
+	// Deny lists status codes that are never served, even if allowed.
+	Deny []StatusRange
+
+	// Reasons provides the reason phrase for a status code, overriding
+	// http.StatusText. Non-standard codes will typically want one.
+	Reasons map[int]string
+
+	// Unsupported handles any request for a status code that is not
+	// served. If nil, http.NotFound is used.
+	Unsupported http.Handler
+
+	// CodeParam extracts the requested status code from the request,
+	// e.g. a named route variable. If nil, the last element of the path
+	// is used, so the handler may be mounted under any prefix.
+	CodeParam func(r *http.Request) string
+
+	// Methods lists the request methods accepted. Any other method is
+	// answered with 405 Method Not Allowed. HEAD is accepted whenever GET
+	// is, and OPTIONS is always accepted. If empty, all methods are accepted.
+	Methods []string
+
+	// Recorder, if set, counts every response served.
+	Recorder *StatusRecorder
+}
+
+// unsupportedCodes are the codes refused by ServeStatus.
+var unsupportedCodes = []StatusRange{
+	// 1xx
+	StatusCode(http.StatusContinue),
+	StatusCode(http.StatusSwitchingProtocols),
+	StatusCode(http.StatusProcessing),
+
+	// 2xx
+	StatusCode(http.StatusMultiStatus),
+	StatusCode(http.StatusAlreadyReported),
+	StatusCode(http.StatusIMUsed),
+
+	// 3xx
+	StatusCode(http.StatusMultipleChoices),
+	StatusCode(http.StatusMovedPermanently),
+	StatusCode(http.StatusFound),
+	StatusCode(http.StatusSeeOther),
+	StatusCode(http.StatusNotModified),
+	StatusCode(http.StatusUseProxy),
+	StatusCode(http.StatusTemporaryRedirect),
+	StatusCode(http.StatusPermanentRedirect),
+}
+
 // ServeStatus provides a handler that will respond with the http status
-// indicated by the path. Only 2xx, 4xx, and 5xx status codes are supported
-// at the moment.
+// indicated by the last element of the path, so it may be mounted under any
+// prefix. Only 2xx, 4xx, and 5xx status codes are supported at the moment.
 func ServeStatus() http.Handler {
-	var blackListCodes = []int{
-		// 1xx
-		http.StatusContinue,
-		http.StatusSwitchingProtocols,
-		http.StatusProcessing,
-
-		// 2xx
-		http.StatusMultiStatus,
-		http.StatusAlreadyReported,
-		http.StatusIMUsed,
-
-		// 3xx
-		http.StatusMultipleChoices,
-		http.StatusMovedPermanently,
-		http.StatusFound,
-		http.StatusSeeOther,
-		http.StatusNotModified,
-		http.StatusUseProxy,
-		http.StatusTemporaryRedirect,
-		http.StatusPermanentRedirect,
-	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		statusCodeString := strings.Trim(r.URL.Path, "/")
+	return ServeStatusWithOptions(StatusOptions{})
+}
+
+// ServeStatusWithOptions provides a handler like ServeStatus, with the set
+// of codes served, their reason phrases, and the response for any other
+// request controlled by opts.
+func ServeStatusWithOptions(opts StatusOptions) http.Handler {
+	unsupported := opts.Unsupported
+	if unsupported == nil {
+		unsupported = http.NotFoundHandler()
+	}
+	codeParam := opts.CodeParam
+	if codeParam == nil {
+		codeParam = lastPathElement
+	}
+	allowed := opts.allowedMethods()
+	allow := strings.Join(allowed, ", ")
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(opts.Methods) > 0 && !containsString(allowed, r.Method) {
+			w.Header().Set("Allow", allow)
+			writeCode(w, r, http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allow)
+		}
+		statusCodeString := codeParam(r)
 		statusCode, err := strconv.Atoi(statusCodeString)
 		if err != nil {
-			http.NotFound(w, r)
+			unsupported.ServeHTTP(w, r)
 			return
 		}
-		statusText := http.StatusText(statusCode)
-		if statusText == "" {
-			http.NotFound(w, r)
+		statusText, ok := opts.reason(statusCode)
+		if !ok {
+			unsupported.ServeHTTP(w, r)
 			return
 		}
-		for _, code := range blackListCodes {
-			if code == statusCode {
-				http.NotFound(w, r)
-				return
-			}
-		}
 		w.Header().Set("x-status-code", statusCodeString)
-		w.Header().Set("x-status", statusText)
-		w.WriteHeader(statusCode)
-		w.Write([]byte(statusCodeString + " " + statusText + "\n"))
+		if statusText != "" {
+			w.Header().Set("x-status", statusText)
+		}
+		writeStatus(w, r, statusCode, statusCodeString, statusText)
 	})
+	if opts.Recorder != nil {
+		h = opts.Recorder.Record(h)
+	}
+	return h
+}
+
+// writeStatus writes the status line as the response body, leaving it out
+// for HEAD requests and for status codes that must not have a body.
+func writeStatus(w http.ResponseWriter, r *http.Request, code int, codeString, text string) {
+	if !bodyAllowed(code) {
+		w.WriteHeader(code)
+		return
+	}
+	body := strings.TrimSpace(codeString+" "+text) + "\n"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		w.Write([]byte(body))
+	}
+}
+
+// writeCode responds with code and its standard status text.
+func writeCode(w http.ResponseWriter, r *http.Request, code int) {
+	writeStatus(w, r, code, strconv.Itoa(code), http.StatusText(code))
+}
+
+// bodyAllowed reports whether a response with code may include a body.
+func bodyAllowed(code int) bool {
+	switch {
+	case code >= 100 && code <= 199:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// defaultMethods are listed in the Allow header when opts.Methods is empty,
+// though any method is accepted.
+var defaultMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// allowedMethods returns the methods listed in the Allow header according to
+// opts, which are the only ones accepted when opts.Methods is given.
+func (opts StatusOptions) allowedMethods() []string {
+	if len(opts.Methods) == 0 {
+		return defaultMethods
+	}
+	var allowed []string
+	for _, m := range opts.Methods {
+		if !containsString(allowed, m) {
+			allowed = append(allowed, m)
+		}
+	}
+	if containsString(allowed, http.MethodGet) && !containsString(allowed, http.MethodHead) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	if !containsString(allowed, http.MethodOptions) {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	return allowed
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// reason returns the reason phrase for code, and whether code may be served.
+func (opts StatusOptions) reason(code int) (string, bool) {
+	if code < 200 || code > 999 {
+		return "", false
+	}
+	for _, sr := range opts.Deny {
+		if sr.contains(code) {
+			return "", false
+		}
+	}
+	statusText, ok := opts.Reasons[code]
+	if !ok {
+		statusText = http.StatusText(code)
+	}
+	if len(opts.Allow) > 0 {
+		for _, sr := range opts.Allow {
+			if sr.contains(code) {
+				return statusText, true
+			}
+		}
+		return "", false
+	}
+	if statusText == "" {
+		return "", false
+	}
+	for _, sr := range unsupportedCodes {
+		if sr.contains(code) {
+			return "", false
+		}
+	}
+	return statusText, true
+}
+
+// lastPathElement returns the final element of the request path, ignoring
+// any trailing slash.
+func lastPathElement(r *http.Request) string {
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	return p[strings.LastIndex(p, "/")+1:]
 }
@@ -181,6 +181,9 @@ func TestServeStatusUnsupportedCodes(t *testing.T) {
 					t.Fatalf("reading response body: %+v", err)
 				}
 				wantBody := []byte("404 page not found\n")
+				if method == http.MethodHead {
+					wantBody = []byte{}
+				}
 				if !bytes.Equal(body, wantBody) {
 					t.Fatalf("request to /%03d returned body %q, expected %q", tc.code, body, wantBody)
 				}
@@ -200,8 +203,7 @@ func TestServeStatusNotCodes(t *testing.T) {
 		{"/", allMethods},
 		{"/foo", allMethods},
 		{"/200/foo", allMethods},
-		{"/bar/200", allMethods},
-		{"/200/400", allMethods},
+		{"/foo/200/bar/", allMethods},
 		{"/1/", allMethods},
 		{"/602", allMethods},
 	}
@@ -234,6 +236,9 @@ func TestServeStatusNotCodes(t *testing.T) {
 					t.Fatalf("reading response body: %+v", err)
 				}
 				wantBody := []byte("404 page not found\n")
+				if method == http.MethodHead {
+					wantBody = []byte{}
+				}
 				if !bytes.Equal(body, wantBody) {
 					t.Fatalf("request to /%q returned body %q, expected %q", tc.path, body, wantBody)
 				}
@@ -242,6 +247,330 @@ func TestServeStatusNotCodes(t *testing.T) {
 	}
 }
 
+func TestServeStatusMounted(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/status/", handy.ServeStatus())
+	mux.Handle("/delayed/status/", handy.ServeWithDelay(handy.ServeStatus()))
+	mux.Handle("/param/", handy.ServeStatusWithOptions(handy.StatusOptions{
+		CodeParam: func(r *http.Request) string { return r.URL.Query().Get("code") },
+	}))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	testCases := []struct {
+		path     string
+		wantCode int
+	}{
+		{"/status/201", http.StatusCreated},
+		{"/status/201/", http.StatusCreated},
+		{"/status/foo/bar/503", http.StatusServiceUnavailable},
+		{"/status/503/foo", http.StatusNotFound},
+		{"/delayed/status/418/1ms", http.StatusTeapot},
+		{"/delayed/status/418", http.StatusTeapot},
+		{"/param/foo?code=202", http.StatusAccepted},
+		{"/param/202", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.path, func(t *testing.T) {
+			res, err := http.Get(s.URL + tc.path)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("request to %q returned status code %03d, expected %03d", tc.path, res.StatusCode, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestServeStatusMethods(t *testing.T) {
+	testCases := []struct {
+		name              string
+		opts              handy.StatusOptions
+		method            string
+		path              string
+		wantCode          int
+		wantBody          string
+		wantContentLength int64
+		wantAllow         string
+	}{
+		{"GET with body",
+			handy.StatusOptions{},
+			http.MethodGet,
+			"/200",
+			http.StatusOK,
+			"200 OK\n",
+			7,
+			"",
+		},
+		{"HEAD without body",
+			handy.StatusOptions{},
+			http.MethodHead,
+			"/200",
+			http.StatusOK,
+			"",
+			7, // matches GET
+			"",
+		},
+		{"no content",
+			handy.StatusOptions{},
+			http.MethodGet,
+			"/204",
+			http.StatusNoContent,
+			"",
+			0,
+			"",
+		},
+		{"not modified",
+			handy.StatusOptions{Allow: []handy.StatusRange{handy.StatusCode(http.StatusNotModified)}},
+			http.MethodGet,
+			"/304",
+			http.StatusNotModified,
+			"",
+			0,
+			"",
+		},
+		{"OPTIONS",
+			handy.StatusOptions{},
+			http.MethodOptions,
+			"/500",
+			http.StatusInternalServerError,
+			"500 Internal Server Error\n",
+			26,
+			"GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, TRACE",
+		},
+		{"extension method",
+			handy.StatusOptions{},
+			"PURGE",
+			"/200",
+			http.StatusOK,
+			"200 OK\n",
+			7,
+			"",
+		},
+		{"OPTIONS restricted",
+			handy.StatusOptions{Methods: []string{http.MethodGet, http.MethodPost}},
+			http.MethodOptions,
+			"/200",
+			http.StatusOK,
+			"200 OK\n",
+			7,
+			"GET, POST, HEAD, OPTIONS",
+		},
+		{"allowed method",
+			handy.StatusOptions{Methods: []string{http.MethodPost}},
+			http.MethodPost,
+			"/201",
+			http.StatusCreated,
+			"201 Created\n",
+			12,
+			"",
+		},
+		{"HEAD allowed by GET",
+			handy.StatusOptions{Methods: []string{http.MethodGet}},
+			http.MethodHead,
+			"/201",
+			http.StatusCreated,
+			"",
+			12,
+			"",
+		},
+		{"method not allowed",
+			handy.StatusOptions{Methods: []string{http.MethodGet}},
+			http.MethodDelete,
+			"/200",
+			http.StatusMethodNotAllowed,
+			"405 Method Not Allowed\n",
+			23,
+			"GET, HEAD, OPTIONS",
+		},
+		{"method not allowed for unsupported code",
+			handy.StatusOptions{Methods: []string{http.MethodPut}},
+			http.MethodPost,
+			"/foo",
+			http.StatusMethodNotAllowed,
+			"405 Method Not Allowed\n",
+			23,
+			"PUT, OPTIONS",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel() // service should be safe for concurrent use
+			s := httptest.NewServer(handy.ServeStatusWithOptions(tc.opts))
+			defer s.Close()
+			req, err := http.NewRequest(tc.method, s.URL+tc.path, nil)
+			if err != nil {
+				t.Fatalf("constructing request: %+v", err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("%s %q returned status code %03d, expected %03d", tc.method, tc.path, res.StatusCode, tc.wantCode)
+			}
+			if res.ContentLength != tc.wantContentLength {
+				t.Fatalf("%s %q returned content length %d, expected %d", tc.method, tc.path, res.ContentLength, tc.wantContentLength)
+			}
+			if res.Header.Get("Allow") != tc.wantAllow {
+				t.Fatalf("%s %q returned Allow header %q, expected %q", tc.method, tc.path, res.Header.Get("Allow"), tc.wantAllow)
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("reading response body: %+v", err)
+			}
+			if string(body) != tc.wantBody {
+				t.Fatalf("%s %q returned body %q, expected %q", tc.method, tc.path, body, tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestServeStatusWithOptions(t *testing.T) {
+	testCases := []struct {
+		name       string
+		opts       handy.StatusOptions
+		path       string
+		wantCode   int
+		wantStatus string
+		wantBody   string
+	}{
+		{"zero value, supported",
+			handy.StatusOptions{},
+			"/200",
+			http.StatusOK,
+			"OK",
+			"200 OK\n",
+		},
+		{"zero value, unsupported",
+			handy.StatusOptions{},
+			"/301",
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+		{"allowed range",
+			handy.StatusOptions{Allow: []handy.StatusRange{{From: 300, To: 399}}},
+			"/301",
+			http.StatusMovedPermanently,
+			"Moved Permanently",
+			"301 Moved Permanently\n",
+		},
+		{"outside allowed range",
+			handy.StatusOptions{Allow: []handy.StatusRange{{From: 300, To: 399}}},
+			"/200",
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+		{"denied code",
+			handy.StatusOptions{Deny: []handy.StatusRange{handy.StatusCode(http.StatusTeapot)}},
+			"/418",
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+		{"denied within allowed range",
+			handy.StatusOptions{
+				Allow: []handy.StatusRange{{From: 500, To: 599}},
+				Deny:  []handy.StatusRange{{From: 502, To: 504}},
+			},
+			"/503",
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+		{"non-standard code with reason",
+			handy.StatusOptions{
+				Allow:   []handy.StatusRange{{From: 520, To: 599}},
+				Reasons: map[int]string{522: "Connection Timed Out"},
+			},
+			"/522",
+			522,
+			"Connection Timed Out",
+			"522 Connection Timed Out\n",
+		},
+		{"non-standard code without reason",
+			handy.StatusOptions{Allow: []handy.StatusRange{{From: 520, To: 599}}},
+			"/599",
+			599,
+			"",
+			"599\n",
+		},
+		{"non-standard code by reason alone",
+			handy.StatusOptions{Reasons: map[int]string{499: "Client Closed Request"}},
+			"/499",
+			499,
+			"Client Closed Request",
+			"499 Client Closed Request\n",
+		},
+		{"overridden reason",
+			handy.StatusOptions{Reasons: map[int]string{http.StatusTeapot: "Short And Stout"}},
+			"/418",
+			http.StatusTeapot,
+			"Short And Stout",
+			"418 Short And Stout\n",
+		},
+		{"out of bounds code",
+			handy.StatusOptions{Allow: []handy.StatusRange{{From: 0, To: 2000}}},
+			"/1000",
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+		{"informational code",
+			handy.StatusOptions{Allow: []handy.StatusRange{{From: 100, To: 199}}},
+			"/103",
+			http.StatusNotFound,
+			"",
+			"404 page not found\n",
+		},
+		{"custom unsupported handler",
+			handy.StatusOptions{Unsupported: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "nope", http.StatusBadRequest)
+			})},
+			"/foo",
+			http.StatusBadRequest,
+			"",
+			"nope\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel() // service should be safe for concurrent use
+			s := httptest.NewServer(handy.ServeStatusWithOptions(tc.opts))
+			defer s.Close()
+			res, err := http.Get(s.URL + tc.path)
+			if err != nil {
+				t.Fatalf("doing request: %+v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("request to %q returned status code %03d, expected %03d", tc.path, res.StatusCode, tc.wantCode)
+			}
+			if res.Header.Get("x-status") != tc.wantStatus {
+				t.Fatalf("request to %q returned x-status header %q, expected %q", tc.path, res.Header.Get("x-status"), tc.wantStatus)
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("reading response body: %+v", err)
+			}
+			if string(body) != tc.wantBody {
+				t.Fatalf("request to %q returned body %q, expected %q", tc.path, body, tc.wantBody)
+			}
+		})
+	}
+}
+
 var (
 	safeMethods = []string{
 		http.MethodGet,